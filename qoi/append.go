@@ -0,0 +1,97 @@
+package qoi
+
+import (
+	"fmt"
+	"image"
+	"io"
+)
+
+// OpenAppend prepares the QOI image starting at the current offset of f for
+// more rows. It decodes the image to rebuild the encoder state, then returns
+// a RowWriter positioned over the end marker. Rows written to it must use
+// the channels of the existing header. Close writes a new end marker and
+// patches the height in the header.
+//
+// For images produced by this package the result is identical to encoding
+// the combined image in one go: a run at the end of the existing image is
+// reopened so that it can continue into the new rows. If f has a
+// Truncate(int64) error method, such as *os.File, data after the end marker
+// is removed.
+//
+// opts limits the existing image like for NewRowReader. A nil opts uses the
+// defaults.
+func OpenAppend(f io.ReadWriteSeeker, opts *DecodeOptions) (*RowWriter, error) {
+	headerPos, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("cannot seek input: %w", err)
+	}
+
+	d := NewDecoder(f, rowOptions(opts))
+	header, err := d.start()
+	if err != nil {
+		return nil, err
+	}
+	row := make([]byte, d.width*4)
+	for y := 0; y < d.height; y++ {
+		err = d.decodePixels(row)
+		if err != nil {
+			return nil, d.wrapErr(err)
+		}
+	}
+	if d.run > 0 {
+		return nil, d.wrapErr(fmt.Errorf("run of %v pixels past the end: %w", d.run, ErrRunOverflow))
+	}
+	endPos, lastChunk, lastChunkPos := d.input.offset, d.chunk, d.chunkStart
+	err = d.finish()
+	if err != nil {
+		return nil, err
+	}
+
+	var runLength byte
+	if lastChunk == ChunkRun {
+		endPos = lastChunkPos
+		runLength, err = readRunLength(f, headerPos+endPos)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if t, ok := f.(interface{ Truncate(int64) error }); ok {
+		err = t.Truncate(headerPos + endPos)
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err = f.Seek(headerPos+endPos, io.SeekStart)
+	if err != nil {
+		return nil, fmt.Errorf("cannot seek output: %w", err)
+	}
+
+	rw := NewSeekingRowWriter(f, header)
+	rw.header.Height = header.Height
+	rw.started = true
+	rw.headerPos = headerPos
+	rw.rows = d.height
+	rw.e.start(image.Rect(0, 0, d.width, d.height))
+	rw.e.cache = d.cache
+	rw.e.prev = d.prev
+	rw.e.runLength = runLength
+	return rw, nil
+}
+
+// readRunLength returns the length of the run chunk at offset pos of f.
+func readRunLength(f io.ReadSeeker, pos int64) (byte, error) {
+	_, err := f.Seek(pos, io.SeekStart)
+	if err != nil {
+		return 0, fmt.Errorf("cannot seek input: %w", err)
+	}
+	var tag [1]byte
+	_, err = io.ReadFull(f, tag[:])
+	if err != nil {
+		return 0, err
+	}
+	if chunkKind(tag[0]) != ChunkRun {
+		return 0, fmt.Errorf("expected run chunk at offset %v: %w", pos, ErrCorrupt)
+	}
+	return tag[0]&^TagMask + 1, nil
+}
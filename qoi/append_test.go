@@ -0,0 +1,161 @@
+package qoi_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/kropptrevor/go-qoi/qoi"
+)
+
+func TestOpenAppend(t *testing.T) {
+	t.Parallel()
+
+	// The solid band makes the split fall inside runs, including runs
+	// longer than one chunk.
+	m := randomImages(image.Rect(0, 0, 40, 12))["NRGBA"].(*image.NRGBA)
+	band := m.SubImage(image.Rect(0, 3, 40, 8)).(*image.NRGBA)
+	for y := 3; y < 8; y++ {
+		for x := 0; x < 40; x++ {
+			band.SetNRGBA(x, y, color.NRGBA{7, 8, 9, 255})
+		}
+	}
+	var expected bytes.Buffer
+	err := qoi.Encode(&expected, m, qoi.ChannelsRGBA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appendRows := func(t *testing.T, f *os.File, split int) {
+		rw, err := qoi.OpenAppend(f, nil)
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		err = rw.WriteRows(m.Pix[split*m.Stride:])
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		err = rw.Close()
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+	}
+
+	for split := 1; split <= 12; split++ {
+		split := split
+		t.Run("Should match Encode after "+strconv.Itoa(split)+" rows", func(t *testing.T) {
+			t.Parallel()
+			f, err := os.Create(filepath.Join(t.TempDir(), "append.qoi"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			err = qoi.Encode(f, m.SubImage(image.Rect(0, 0, 40, split)), qoi.ChannelsRGBA)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = f.Seek(0, io.SeekStart)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			appendRows(t, f, split)
+
+			actual, err := os.ReadFile(f.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(expected.Bytes(), actual) {
+				t.Fatal("expected appended output to match Encode output")
+			}
+		})
+	}
+
+	t.Run("Should append at the current offset and drop trailing data", func(t *testing.T) {
+		t.Parallel()
+		f, err := os.Create(filepath.Join(t.TempDir(), "append.qoi"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		_, err = f.WriteString("prefix")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = qoi.Encode(f, m.SubImage(image.Rect(0, 0, 40, 5)), qoi.ChannelsRGBA)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.WriteString("trailing data that is longer than the new rows could ever be")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.Seek(int64(len("prefix")), io.SeekStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		appendRows(t, f, 5)
+
+		actual, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(append([]byte("prefix"), expected.Bytes()...), actual) {
+			t.Fatal("expected appended output to match Encode output")
+		}
+	})
+
+	t.Run("Should reject widths above the default row limit", func(t *testing.T) {
+		t.Parallel()
+		f, err := os.Create(filepath.Join(t.TempDir(), "append.qoi"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		_, err = f.Write([]byte{'q', 'o', 'i', 'f', 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 1, byte(qoi.ChannelsRGBA), qoi.ColorSpaceSRGB})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.Seek(0, io.SeekStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = qoi.OpenAppend(f, nil)
+
+		expected := qoi.ErrTooLarge
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should fail with truncated image", func(t *testing.T) {
+		t.Parallel()
+		f, err := os.Create(filepath.Join(t.TempDir(), "append.qoi"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		_, err = f.Write(expected.Bytes()[:expected.Len()/2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.Seek(0, io.SeekStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = qoi.OpenAppend(f, nil)
+
+		if !errors.Is(err, qoi.ErrTruncated) {
+			t.Fatalf("expected %q but got %q", qoi.ErrTruncated, err)
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package qoi
+
+import "math"
+
+// ColorConversion selects a transfer function conversion applied to the
+// color components of decoded pixels. Alpha is never converted.
+type ColorConversion uint8
+
+const (
+	// ConvertNone returns the components as stored.
+	ConvertNone ColorConversion = iota
+	// ConvertToSRGB converts images tagged ColorSpaceLinear to sRGB.
+	ConvertToSRGB
+	// ConvertToLinear converts images tagged ColorSpaceSRGB to linear.
+	ConvertToLinear
+)
+
+var srgbToLinear, linearToSRGB [256]byte
+
+func init() {
+	for i := range srgbToLinear {
+		v := float64(i) / 255
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		srgbToLinear[i] = byte(math.Round(v * 255))
+	}
+	for i := range linearToSRGB {
+		v := float64(i) / 255
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+		linearToSRGB[i] = byte(math.Round(v * 255))
+	}
+}
+
+// SRGBToLinear converts an 8-bit sRGB component to linear light.
+func SRGBToLinear(c byte) byte {
+	return srgbToLinear[c]
+}
+
+// LinearToSRGB converts an 8-bit linear component to sRGB.
+func LinearToSRGB(c byte) byte {
+	return linearToSRGB[c]
+}
+
+// convertColorSpace applies conv to NRGBA pixels stored in color space cs.
+func convertColorSpace(pix []byte, cs uint8, conv ColorConversion) {
+	var table *[256]byte
+	switch {
+	case conv == ConvertToSRGB && cs == ColorSpaceLinear:
+		table = &linearToSRGB
+	case conv == ConvertToLinear && cs == ColorSpaceSRGB:
+		table = &srgbToLinear
+	default:
+		return
+	}
+	for i := 0; i+3 < len(pix); i += 4 {
+		pix[i+0] = table[pix[i+0]]
+		pix[i+1] = table[pix[i+1]]
+		pix[i+2] = table[pix[i+2]]
+	}
+}
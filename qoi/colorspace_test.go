@@ -0,0 +1,152 @@
+package qoi_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/kropptrevor/go-qoi/qoi"
+)
+
+func TestColorSpaceHelpers(t *testing.T) {
+	t.Parallel()
+
+	toLinear := map[byte]byte{0: 0, 10: 1, 188: 128, 255: 255}
+	for c, expected := range toLinear {
+		if actual := qoi.SRGBToLinear(c); actual != expected {
+			t.Fatalf("expected SRGBToLinear(%v) = %v but got %v", c, expected, actual)
+		}
+	}
+	toSRGB := map[byte]byte{0: 0, 1: 13, 128: 188, 255: 255}
+	for c, expected := range toSRGB {
+		if actual := qoi.LinearToSRGB(c); actual != expected {
+			t.Fatalf("expected LinearToSRGB(%v) = %v but got %v", c, expected, actual)
+		}
+	}
+}
+
+func TestDecodeConvert(t *testing.T) {
+	t.Parallel()
+
+	m := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	m.SetNRGBA(0, 0, color.NRGBA{128, 0, 255, 128})
+	m.SetNRGBA(1, 0, color.NRGBA{188, 10, 188, 255})
+	encode := func(t *testing.T, colorSpace uint8) []byte {
+		var buf bytes.Buffer
+		err := qoi.EncodeWithOptions(&buf, m, &qoi.Options{ColorSpace: colorSpace})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	cases := []struct {
+		name       string
+		colorSpace uint8
+		convert    qoi.ColorConversion
+		expected   []byte
+	}{
+		{"linear to sRGB", qoi.ColorSpaceLinear, qoi.ConvertToSRGB, []byte{188, 0, 255, 128, 223, 56, 223, 255}},
+		{"sRGB to linear", qoi.ColorSpaceSRGB, qoi.ConvertToLinear, []byte{55, 0, 255, 128, 128, 1, 128, 255}},
+		{"sRGB to sRGB", qoi.ColorSpaceSRGB, qoi.ConvertToSRGB, []byte{128, 0, 255, 128, 188, 10, 188, 255}},
+		{"linear unconverted", qoi.ColorSpaceLinear, qoi.ConvertNone, []byte{128, 0, 255, 128, 188, 10, 188, 255}},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run("Should convert "+c.name, func(t *testing.T) {
+			t.Parallel()
+			data := encode(t, c.colorSpace)
+
+			actual, header, err := qoi.DecodeWithHeader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if header.ColorSpace != c.colorSpace {
+				t.Fatalf("expected color space %v but got %v", c.colorSpace, header.ColorSpace)
+			}
+			actual, err = qoi.DecodeWithOptions(bytes.NewReader(data), &qoi.DecodeOptions{Convert: c.convert})
+
+			if err != nil {
+				t.Fatalf("expected nil error, but got %v", err)
+			}
+			if pix := actual.(*image.NRGBA).Pix; !bytes.Equal(c.expected, pix) {
+				t.Fatalf("expected %v but got %v", c.expected, pix)
+			}
+		})
+	}
+}
+
+func TestDecodeConvertPaths(t *testing.T) {
+	t.Parallel()
+
+	m := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	m.SetNRGBA(0, 0, color.NRGBA{128, 0, 255, 128})
+	m.SetNRGBA(1, 0, color.NRGBA{188, 10, 188, 255})
+	var buf bytes.Buffer
+	err := qoi.EncodeWithOptions(&buf, m, &qoi.Options{ColorSpace: qoi.ColorSpaceLinear})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	opts := &qoi.DecodeOptions{Convert: qoi.ConvertToSRGB}
+	expected := &image.NRGBA{
+		Pix:    []byte{188, 0, 255, 128, 223, 56, 223, 255},
+		Stride: 8,
+		Rect:   m.Rect,
+	}
+
+	destinations := map[string]draw.Image{
+		"NRGBA":   image.NewNRGBA(m.Rect),
+		"RGBA":    image.NewRGBA(m.Rect),
+		"NRGBA64": image.NewNRGBA64(m.Rect),
+	}
+	for name, dst := range destinations {
+		name, dst := name, dst
+		t.Run("Should convert when decoding into "+name, func(t *testing.T) {
+			t.Parallel()
+
+			err := qoi.NewDecoder(bytes.NewReader(data), opts).DecodeInto(dst, image.Point{})
+
+			if err != nil {
+				t.Fatalf("expected nil error, but got %v", err)
+			}
+			for x := 0; x < 2; x++ {
+				want := dst.ColorModel().Convert(expected.At(x, 0))
+				if dst.At(x, 0) != want {
+					t.Fatalf("expected color %v but got %v at %v", want, dst.At(x, 0), x)
+				}
+			}
+		})
+	}
+
+	t.Run("Should convert raw pixels", func(t *testing.T) {
+		t.Parallel()
+
+		actual, err := qoi.NewDecoder(bytes.NewReader(data), opts).DecodeRaw(qoi.LayoutRGBA)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		if !bytes.Equal(expected.Pix, actual) {
+			t.Fatalf("expected %v but got %v", expected.Pix, actual)
+		}
+	})
+
+	t.Run("Should convert rows", func(t *testing.T) {
+		t.Parallel()
+		rr, err := qoi.NewRowReader(bytes.NewReader(data), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !rr.Next() {
+			t.Fatalf("expected a row but got %v", rr.Err())
+		}
+
+		if !bytes.Equal(expected.Pix, rr.Row()) {
+			t.Fatalf("expected %v but got %v", expected.Pix, rr.Row())
+		}
+	})
+}
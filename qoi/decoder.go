@@ -1,101 +1,596 @@
 package qoi
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
 	"io"
+	"math"
 )
 
 var ErrParseHeader = errors.New("failed to parse QOI header")
 
 var ErrParseEndMarker = errors.New("failed to parse QOI end marker")
 
+var ErrRunOverflow = errors.New("run exceeds image size")
+
+var ErrTrailingData = errors.New("trailing data after end marker")
+
+var ErrTooSmall = errors.New("destination too small")
+
+var errNoReader = errors.New("decoder has no reader, use NewDecoder or Reset")
+
+func init() {
+	image.RegisterFormat("qoi", "qoif", Decode, DecodeConfig)
+}
+
+// DecodeConfig returns the color model and dimensions of a QOI image without
+// decoding it.
+func DecodeConfig(input io.Reader) (image.Config, error) {
+	header, err := ReadHeader(input)
+	if err != nil {
+		return image.Config{}, err
+	}
+
+	return image.Config{
+		ColorModel: color.NRGBAModel,
+		Width:      int(header.Width),
+		Height:     int(header.Height),
+	}, nil
+}
+
+// ReadHeader reads the header of a QOI image.
+func ReadHeader(input io.Reader) (Header, error) {
+	d := Decoder{
+		input: newReader(input),
+	}
+	header, err := d.parseHeader()
+	return header, d.wrapErr(err)
+}
+
+// Decode reads a QOI image from input.
 func Decode(input io.Reader) (image.Image, error) {
-	d := decoder{
-		input: input,
-		cache: [64]rgba{},
+	m, _, err := DecodeWithHeader(input)
+	return m, err
+}
+
+// DecodeWithHeader is like Decode but also returns the header.
+func DecodeWithHeader(input io.Reader) (image.Image, Header, error) {
+	return NewDecoder(input, nil).decode()
+}
+
+// DecodeBytes decodes a QOI image held in memory. The returned image does not
+// share memory with data.
+func DecodeBytes(data []byte) (image.Image, error) {
+	d := Decoder{
+		input: newBytesReader(data),
 	}
-	width, height, err := d.parseHeader()
-	if err != nil {
-		return nil, err
+	return d.Decode()
+}
+
+// DefaultMaxPixels is the pixel limit recommended by the QOI specification.
+const DefaultMaxPixels = 400_000_000
+
+// DecodeMode selects how the decoder treats streams that do not conform
+// to the QOI specification.
+type DecodeMode uint8
+
+const (
+	// DecodeDefault drops pixels of runs that exceed the image, accepts
+	// RGBA chunks in 3-channel streams and ignores trailing data.
+	DecodeDefault DecodeMode = iota
+	// DecodeStrict rejects each of those with ErrRunOverflow,
+	// ErrChannelMismatch and ErrTrailingData.
+	DecodeStrict
+	// DecodeLenient behaves like DecodeDefault and additionally accepts a
+	// missing or malformed end marker once all pixels are decoded.
+	DecodeLenient
+)
+
+// DecodeOptions configures DecodeWithOptions, NewDecoder, NewRowReader and
+// OpenAppend. A nil *DecodeOptions uses the defaults.
+//
+// MaxWidth, MaxHeight and MaxPixels limit the accepted image sizes. A zero
+// MaxWidth or MaxHeight means no limit. A zero MaxPixels means
+// DefaultMaxPixels. NewRowReader and OpenAppend keep a single row, so they
+// ignore MaxPixels and use DefaultMaxRowWidth for a zero MaxWidth.
+//
+// Partial and Output only apply where a whole image is returned. OpenAppend
+// uses only the limits and Mode.
+type DecodeOptions struct {
+	MaxWidth  uint32
+	MaxHeight uint32
+	MaxPixels uint64
+	// Mode selects how streams that do not conform to the specification
+	// are treated.
+	Mode DecodeMode
+	// Partial makes DecodeWithOptions return the pixels decoded so far
+	// along with a *TruncatedError when the stream ends early. Pixels that
+	// were never decoded are transparent black. Partial images are always
+	// *image.NRGBA.
+	Partial bool
+	// Output selects the type of the decoded image.
+	Output OutputType
+	// Convert converts the decoded colors to another color space. The
+	// returned Header still reports the color space of the stream.
+	Convert ColorConversion
+	// Progress, if not nil, is called after each decoded row.
+	Progress ProgressFunc
+}
+
+func (o *DecodeOptions) check(header Header) error {
+	maxPixels := o.MaxPixels
+	if maxPixels == 0 {
+		maxPixels = DefaultMaxPixels
+	}
+	pixels := uint64(header.Width) * uint64(header.Height)
+	switch {
+	case o.MaxWidth != 0 && header.Width > o.MaxWidth,
+		o.MaxHeight != 0 && header.Height > o.MaxHeight,
+		pixels > maxPixels,
+		pixels > math.MaxInt/4:
+		return fmt.Errorf("size %vx%v exceeds limits: %w", header.Width, header.Height, ErrTooLarge)
 	}
+	return nil
+}
+
+func DecodeWithOptions(input io.Reader, opts *DecodeOptions) (image.Image, error) {
+	m, _, err := NewDecoder(input, opts).decode()
+	return m, err
+}
+
+// DecodeContext is like DecodeWithOptions but stops with the error of ctx
+// once ctx is done. ctx is checked before each row.
+func DecodeContext(ctx context.Context, input io.Reader, opts *DecodeOptions) (image.Image, error) {
+	d := NewDecoder(input, opts)
+	d.ctx = ctx
+	m, _, err := d.decode()
+	return m, err
+}
+
+func DecodeInto(input io.Reader, dst draw.Image, at image.Point) error {
+	return NewDecoder(input, nil).DecodeInto(dst, at)
+}
+
+// Decoder reads QOI images from an io.Reader. Unless the reader is an
+// io.ByteReader, input is buffered and the Decoder may read past the end of
+// an image; further images are decoded from the buffer. This holds for every
+// function in this package that decodes from an io.Reader. Its buffers are kept
+// between images, so reusing a Decoder, for example through a sync.Pool,
+// avoids allocating for each image apart from the image itself. A Decoder
+// must not be used concurrently. Create one with NewDecoder; a zero Decoder
+// fails to decode until Reset gives it a reader.
+type Decoder struct {
+	ctx        context.Context
+	input      reader
+	opts       DecodeOptions
+	header     Header
+	channels   Channels
+	cache      [64]rgba
+	pix        []byte
+	row        []byte
+	pixLen     int
+	width      int
+	height     int
+	total      int
+	pixels     int
+	prev       rgba
+	run        int
+	chunkStart int64
+	chunk      ChunkKind
+}
+
+func NewDecoder(input io.Reader, opts *DecodeOptions) *Decoder {
+	d := &Decoder{
+		input: newReader(input),
+	}
+	if opts != nil {
+		d.opts = *opts
+	}
+	return d
+}
+
+// Reset discards any buffered input and makes d read from input, keeping
+// its options and buffers.
+func (d *Decoder) Reset(input io.Reader) {
+	d.input.reset(input)
+}
 
-	d.img = image.NewNRGBA(image.Rectangle{
-		Min: image.Point{0, 0},
-		Max: image.Point{int(width), int(height)},
-	})
+// Header returns the header of the image most recently decoded by d.
+func (d *Decoder) Header() Header {
+	return d.header
+}
+
+func (d *Decoder) Decode() (image.Image, error) {
+	m, _, err := d.decode()
+	return m, err
+}
+
+func (d *Decoder) decode() (image.Image, Header, error) {
+	header, err := d.start()
+	if err != nil {
+		return nil, Header{}, err
+	}
 
 	err = d.parseChunks()
+	d.convertColorSpace(d.pix)
+	var truncated *TruncatedError
+	if errors.As(err, &truncated) && d.opts.Partial {
+		d.growPix(d.pixLen)
+		err = d.wrapErr(err)
+		d.pix = d.pix[:d.pixLen]
+		return d.image(), header, err
+	}
 	if err != nil {
-		return nil, err
+		return nil, Header{}, d.wrapErr(err)
 	}
 
-	err = d.parseEndMarker()
+	err = d.finish()
 	if err != nil {
-		return nil, err
+		return nil, Header{}, err
 	}
 
-	return d.img, nil
+	m, err := convert(d.image(), d.opts.Output)
+	if err != nil {
+		return nil, Header{}, err
+	}
+	return m, header, nil
 }
 
-type decoder struct {
-	input io.Reader
-	cache [64]rgba
-	img   *image.NRGBA
-	prev  rgba
-	x     int
-	y     int
+// DecodeInto decodes the next image into dst with its top left corner at
+// the given point.
+func (d *Decoder) DecodeInto(dst draw.Image, at image.Point) error {
+	_, err := d.start()
+	if err != nil {
+		return err
+	}
+
+	err = d.decodeInto(dst, at)
+	if err != nil {
+		return d.wrapErr(err)
+	}
+
+	return d.finish()
 }
 
-func (d *decoder) parseHeader() (width uint32, height uint32, err error) {
-	magic := make([]byte, 4)
-	err = binary.Read(d.input, binary.BigEndian, magic)
+// start parses the header, checks it against opts and prepares the decoder
+// for the pixel data. Returned errors are already wrapped.
+func (d *Decoder) start() (Header, error) {
+	if d.input.src == nil && d.input.err == nil {
+		return Header{}, errNoReader
+	}
+	d.chunkStart = d.input.offset
+	d.chunk = ChunkNone
+	d.pix = nil
+	d.pixels = 0
+	d.width = 0
+	header, err := d.parseHeader()
 	if err != nil {
-		return 0, 0, err
+		return Header{}, d.wrapErr(err)
+	}
+	err = d.opts.check(header)
+	if err != nil {
+		return Header{}, d.wrapErr(err)
 	}
 
-	correctMagic := []byte{'q', 'o', 'i', 'f'}
-	if string(magic) != string(correctMagic) {
-		return 0, 0, fmt.Errorf("bad magic bytes: %w", ErrParseHeader)
+	d.header = header
+	d.channels = header.Channels
+	d.width = int(header.Width)
+	d.height = int(header.Height)
+	d.total = d.width * d.height
+	d.pixLen = d.total * 4
+	d.cache = [64]rgba{}
+	d.prev = rgba{
+		R: 0,
+		G: 0,
+		B: 0,
+		A: 255,
 	}
+	d.run = 0
+	return header, nil
+}
 
-	err = binary.Read(d.input, binary.BigEndian, &width)
-	if err != nil {
-		return 0, 0, err
+// finish parses the end marker and, in strict mode, checks for trailing
+// data. Returned errors are already wrapped.
+func (d *Decoder) finish() error {
+	err := d.parseEndMarker()
+	if err != nil && !(d.opts.Mode == DecodeLenient && errors.Is(err, ErrParseEndMarker)) {
+		return d.wrapErr(err)
 	}
 
-	err = binary.Read(d.input, binary.BigEndian, &height)
+	if d.opts.Mode == DecodeStrict {
+		err = d.parseTrailingData()
+		if err != nil {
+			return d.wrapErr(err)
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) decodeInto(dst draw.Image, at image.Point) error {
+	rect := image.Rectangle{Min: at, Max: at.Add(image.Pt(d.width, d.height))}
+	if !rect.In(dst.Bounds()) {
+		return fmt.Errorf("%v does not fit in %v: %w", rect, dst.Bounds(), ErrTooSmall)
+	}
+	// Empty rectangles fit anywhere, and an image without pixels has no
+	// chunks to decode.
+	if rect.Empty() {
+		return nil
+	}
+
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		err := checkContext(d.ctx)
+		if err != nil {
+			return err
+		}
+		err = d.decodeRowInto(dst, rect.Min.X, y)
+		if err != nil {
+			return err
+		}
+		d.rowDone(y - rect.Min.Y + 1)
+	}
+	return nil
+}
+
+// decodeRowInto decodes the next row into dst starting at (x, y).
+func (d *Decoder) decodeRowInto(dst draw.Image, x, y int) error {
+	switch dst := dst.(type) {
+	case *image.NRGBA:
+		i := dst.PixOffset(x, y)
+		row := dst.Pix[i : i+d.width*4]
+		before := d.pixels
+		err := d.decodePixels(row)
+		d.convertColorSpace(row[:(d.pixels-before)*4])
+		return err
+
+	case *image.RGBA:
+		i := dst.PixOffset(x, y)
+		row := dst.Pix[i : i+d.width*4]
+		before := d.pixels
+		err := d.decodePixels(row)
+		decoded := row[:(d.pixels-before)*4]
+		d.convertColorSpace(decoded)
+		premultiply(decoded)
+		return err
+
+	default:
+		if cap(d.row) < d.width*4 {
+			d.row = make([]byte, d.width*4)
+		}
+		row := d.row[:d.width*4]
+		err := d.decodePixels(row)
+		if err != nil {
+			return err
+		}
+		d.convertColorSpace(row)
+		for i := 0; i < d.width; i++ {
+			c := color.NRGBA{row[4*i], row[4*i+1], row[4*i+2], row[4*i+3]}
+			dst.Set(x+i, y, c)
+		}
+		return nil
+	}
+}
+
+// convertColorSpace applies opts.Convert to decoded NRGBA pixels.
+func (d *Decoder) convertColorSpace(pix []byte) {
+	convertColorSpace(pix, d.header.ColorSpace, d.opts.Convert)
+}
+
+// premultiply converts NRGBA pixels to RGBA in place, rounding the same way
+// as color.RGBAModel.
+func premultiply(pix []byte) {
+	for i := 0; i < len(pix); i += 4 {
+		a := uint32(pix[i+3])
+		if a == 0xff {
+			continue
+		}
+		pix[i+0] = byte(uint32(pix[i+0]) * 0x101 * a / 0xff >> 8)
+		pix[i+1] = byte(uint32(pix[i+1]) * 0x101 * a / 0xff >> 8)
+		pix[i+2] = byte(uint32(pix[i+2]) * 0x101 * a / 0xff >> 8)
+	}
+}
+
+// initialPixCap bounds the first allocation for pixel data so that a header
+// claiming a huge image costs nothing until chunks actually arrive.
+const initialPixCap = 1 << 16
+
+const readerBufferSize = 4096
+
+// reader reads from src through an internal buffer. When src is an
+// io.ByteReader it is read one byte at a time instead, so that nothing past
+// the end of the QOI stream is consumed from it. offset counts the bytes
+// consumed by the decoder.
+type reader struct {
+	src        io.Reader
+	byteReader io.ByteReader
+	buf        []byte
+	pos        int
+	offset     int64
+	err        error
+}
+
+func newReader(src io.Reader) reader {
+	var r reader
+	r.reset(src)
+	return r
+}
+
+// newBytesReader returns a reader that consumes data directly, without an
+// underlying io.Reader.
+func newBytesReader(data []byte) reader {
+	return reader{
+		buf: data,
+		err: io.EOF,
+	}
+}
+
+func (r *reader) reset(src io.Reader) {
+	r.src = src
+	r.byteReader, _ = src.(io.ByteReader)
+	if r.byteReader == nil && r.buf == nil {
+		r.buf = make([]byte, 0, readerBufferSize)
+	}
+	r.buf = r.buf[:0]
+	r.pos = 0
+	r.offset = 0
+	r.err = nil
+}
+
+func (r *reader) readByte() (byte, error) {
+	if r.pos < len(r.buf) {
+		b := r.buf[r.pos]
+		r.pos++
+		r.offset++
+		return b, nil
+	}
+	return r.readByteSlow()
+}
+
+func (r *reader) readByteSlow() (byte, error) {
+	if r.byteReader != nil {
+		b, err := r.byteReader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		r.offset++
+		return b, nil
+	}
+
+	err := r.fill()
 	if err != nil {
-		return 0, 0, err
+		return 0, err
 	}
+	return r.readByte()
+}
 
-	var channels uint8
-	err = binary.Read(d.input, binary.BigEndian, &channels)
+func (r *reader) fill() error {
+	if r.err != nil {
+		return r.err
+	}
+	for i := 0; i < 100; i++ {
+		n, err := r.src.Read(r.buf[:cap(r.buf)])
+		r.buf = r.buf[:n]
+		r.pos = 0
+		if err != nil {
+			r.err = err
+		}
+		if n > 0 {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	r.err = io.ErrNoProgress
+	return r.err
+}
+
+// readFull reads exactly len(p) bytes. Like io.ReadFull, it returns io.EOF
+// if no bytes were read and io.ErrUnexpectedEOF if only some were.
+func (r *reader) readFull(p []byte) error {
+	if n := copy(p, r.buf[r.pos:]); n == len(p) {
+		r.pos += n
+		r.offset += int64(n)
+		return nil
+	}
+	for i := range p {
+		b, err := r.readByte()
+		if errors.Is(err, io.EOF) && i > 0 {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		p[i] = b
+	}
+	return nil
+}
+
+func (d *Decoder) wrapErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = d.truncatedErr()
+	}
+
+	var x, y int
+	if d.width > 0 {
+		x = d.pixels % d.width
+		y = d.pixels / d.width
+	}
+	return &DecodeError{
+		Offset: d.chunkStart,
+		X:      x,
+		Y:      y,
+		Chunk:  d.chunk,
+		Err:    err,
+	}
+}
+
+func (d *Decoder) truncatedErr() *TruncatedError {
+	var rows int
+	if d.width > 0 {
+		rows = d.pixels / d.width
+	}
+	return &TruncatedError{
+		Pixels: d.pixels,
+		Rows:   rows,
+	}
+}
+
+func (d *Decoder) image() *image.NRGBA {
+	return &image.NRGBA{
+		Pix:    d.pix,
+		Stride: d.width * 4,
+		Rect:   image.Rect(0, 0, d.width, d.height),
+	}
+}
+
+func (d *Decoder) parseHeader() (header Header, err error) {
+	var magic [4]byte
+	err = d.input.readFull(magic[:])
 	if err != nil {
-		return 0, 0, err
+		return Header{}, err
 	}
-	if channels != uint8(ChannelsRGB) && channels != uint8(ChannelsRGBA) {
-		return 0, 0, fmt.Errorf("bad channels %v: %w", channels, ErrParseHeader)
+
+	if magic != [4]byte{'q', 'o', 'i', 'f'} {
+		return Header{}, fmt.Errorf("bad magic bytes: %w", ErrParseHeader)
 	}
 
-	var colorSpace uint8
-	err = binary.Read(d.input, binary.BigEndian, &colorSpace)
+	var fields [10]byte
+	err = d.input.readFull(fields[:])
+	if errors.Is(err, io.EOF) {
+		return Header{}, io.ErrUnexpectedEOF
+	}
 	if err != nil {
-		return 0, 0, err
+		return Header{}, err
 	}
-	if colorSpace != ColorSpaceSRGB && colorSpace != ColorSpaceLinear {
-		return 0, 0, fmt.Errorf("bad color space %v: %w", colorSpace, ErrParseHeader)
+	header.Width = binary.BigEndian.Uint32(fields[0:4])
+	header.Height = binary.BigEndian.Uint32(fields[4:8])
+	header.Channels = Channels(fields[8])
+	header.ColorSpace = fields[9]
+
+	if header.Channels != ChannelsRGB && header.Channels != ChannelsRGBA {
+		return Header{}, fmt.Errorf("bad channels %v: %w", header.Channels, ErrParseHeader)
+	}
+
+	if header.ColorSpace != ColorSpaceSRGB && header.ColorSpace != ColorSpaceLinear {
+		return Header{}, fmt.Errorf("bad color space %v: %w", header.ColorSpace, ErrParseHeader)
 	}
 
-	return
+	return header, nil
 }
 
-func (d *decoder) parseEndMarker() error {
-	var endMarker uint64
-	err := binary.Read(d.input, binary.BigEndian, &endMarker)
+func (d *Decoder) parseEndMarker() error {
+	d.chunkStart = d.input.offset
+	d.chunk = ChunkNone
+	var bs [8]byte
+	err := d.input.readFull(bs[:])
 	if err != nil {
 		if errors.Is(err, io.EOF) {
 			return fmt.Errorf("missing end marker: %w", ErrParseEndMarker)
@@ -105,6 +600,7 @@ func (d *decoder) parseEndMarker() error {
 		}
 		return err
 	}
+	endMarker := binary.BigEndian.Uint64(bs[:])
 	if endMarker != 1 {
 		return fmt.Errorf("bad end marker %v: %w", endMarker, ErrParseEndMarker)
 	}
@@ -112,68 +608,155 @@ func (d *decoder) parseEndMarker() error {
 	return nil
 }
 
-func (d *decoder) parseChunks() error {
-	d.prev = rgba{
-		R: 0,
-		G: 0,
-		B: 0,
-		A: 255,
+func (d *Decoder) parseTrailingData() error {
+	d.chunkStart = d.input.offset
+	_, err := d.input.readByte()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrTrailingData
+}
+
+func (d *Decoder) parseChunks() error {
+	pixCap := d.pixLen
+	if pixCap > initialPixCap {
+		pixCap = initialPixCap
 	}
-	width := d.img.Bounds().Dx()
-	height := d.img.Bounds().Dy()
-	d.x = 0
-	d.y = 0
-	for d.x < width && d.y < height {
-		err := d.parseChunk()
+	d.pix = make([]byte, 0, pixCap)
+	rowSize := d.width * 4
+	for len(d.pix) < d.pixLen {
+		err := checkContext(d.ctx)
 		if err != nil {
 			return err
 		}
+		if len(d.pix) == cap(d.pix) {
+			newCap := cap(d.pix) * 2
+			if newCap > d.pixLen {
+				newCap = d.pixLen
+			}
+			d.growPix(newCap)
+		}
+		// Stop at the end of the row so that the context and progress are
+		// handled once per row.
+		start := len(d.pix)
+		end := start - start%rowSize + rowSize
+		if end > cap(d.pix) {
+			end = cap(d.pix)
+		}
+		d.pix = d.pix[:end]
+		err = d.decodePixels(d.pix[start:])
+		if err != nil {
+			d.pix = d.pix[:d.pixels*4]
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return d.truncatedErr()
+		}
+		if err != nil {
+			return err
+		}
+		if end%rowSize == 0 {
+			d.rowDone(end / rowSize)
+		}
 	}
 	return nil
 }
 
-func (d *decoder) updateIndex(pixel rgba) {
+func (d *Decoder) rowDone(rows int) {
+	if d.opts.Progress != nil {
+		d.opts.Progress(rows, d.height)
+	}
+}
+
+func (d *Decoder) growPix(newCap int) {
+	if cap(d.pix) >= newCap {
+		return
+	}
+	pix := make([]byte, len(d.pix), newCap)
+	copy(pix, d.pix)
+	d.pix = pix
+}
+
+func (d *Decoder) updateIndex(pixel rgba) {
 	index := pixel.index()
 	d.cache[index] = pixel
 }
 
-func (d *decoder) parseChunk() error {
-	var b byte
-	err := binary.Read(d.input, binary.BigEndian, &b)
+// decodePixels fills pix with the next len(pix)/4 pixels of the image,
+// first finishing any run left over from the previous call.
+func (d *Decoder) decodePixels(pix []byte) error {
+	off := 0
+	for off < len(pix) {
+		var err error
+		if d.run > 0 {
+			off = d.fillRun(pix, off)
+		} else {
+			off, err = d.parseChunk(pix, off)
+		}
+		if err != nil {
+			d.pixels += off / 4
+			return err
+		}
+	}
+	d.pixels += len(pix) / 4
+	return nil
+}
+
+func (d *Decoder) fillRun(pix []byte, off int) int {
+	n := d.run
+	if free := (len(pix) - off) / 4; n > free {
+		n = free
+	}
+	run := pix[off : off+n*4]
+	run[0] = d.prev.R
+	run[1] = d.prev.G
+	run[2] = d.prev.B
+	run[3] = d.prev.A
+	for filled := 4; filled < len(run); filled *= 2 {
+		copy(run[filled:], run[:filled])
+	}
+	d.run -= n
+	return off + n*4
+}
+
+func (d *Decoder) parseChunk(pix []byte, off int) (int, error) {
+	d.chunkStart = d.input.offset
+	d.chunk = ChunkNone
+	b, err := d.input.readByte()
 	if err != nil {
-		return err
+		return off, err
 	}
+	d.chunk = chunkKind(b)
 	var pixel rgba
 	switch {
 	case b == TagRGB:
 		bs := [3]byte{}
-		err = binary.Read(d.input, binary.BigEndian, &bs)
+		err = d.input.readFull(bs[:])
 		if err != nil {
-			return err
+			return off, err
 		}
 
-		pixel = rgba{bs[0], bs[1], bs[2], 255}
-		d.img.SetNRGBA(d.x, d.y, color.NRGBA(pixel))
-		d.nextXY()
+		pixel = rgba{bs[0], bs[1], bs[2], d.prev.A}
 		d.updateIndex(pixel)
 
 	case b == TagRGBA:
+		if d.opts.Mode == DecodeStrict && d.channels == ChannelsRGB {
+			return off, fmt.Errorf("RGBA chunk in RGB image: %w", ErrChannelMismatch)
+		}
 		bs := [4]byte{}
-		err = binary.Read(d.input, binary.BigEndian, &bs)
+		err = d.input.readFull(bs[:])
 		if err != nil {
-			return err
+			return off, err
 		}
 
 		pixel = rgba{bs[0], bs[1], bs[2], bs[3]}
-		d.img.SetNRGBA(d.x, d.y, color.NRGBA(pixel))
-		d.nextXY()
 		d.updateIndex(pixel)
 
 	case b&TagMask == TagIndex:
 		index := b & ^TagMask
 		pixel = d.cache[index]
-		d.img.SetNRGBA(d.x, d.y, color.NRGBA(pixel))
-		d.nextXY()
 
 	case b&TagMask == TagDiff:
 		const bias = 2
@@ -185,15 +768,12 @@ func (d *decoder) parseChunk() error {
 		pixel.R += dr
 		pixel.G += dg
 		pixel.B += db
-		d.img.SetNRGBA(d.x, d.y, color.NRGBA(pixel))
-		d.nextXY()
 		d.updateIndex(pixel)
 
 	case b&TagMask == TagLuma:
-		var b2 byte
-		err = binary.Read(d.input, binary.BigEndian, &b2)
+		b2, err := d.input.readByte()
 		if err != nil {
-			return err
+			return off, err
 		}
 
 		const gBias = 32
@@ -206,30 +786,23 @@ func (d *decoder) parseChunk() error {
 		pixel.R += (drdg + dg)
 		pixel.G += dg
 		pixel.B += (dbdg + dg)
-		d.img.SetNRGBA(d.x, d.y, color.NRGBA(pixel))
-		d.nextXY()
 		d.updateIndex(pixel)
 
 	case b&TagMask == TagRun:
-		pixel = d.prev
 		const bias = 1
-		length := b&0b_11_11_11 + bias
-		for i := 0; i < int(length); i++ {
-			d.img.SetNRGBA(d.x, d.y, color.NRGBA(pixel))
-			d.nextXY()
+		length := int(b&0b_11_11_11 + bias)
+		remaining := d.total - d.pixels - off/4
+		if d.opts.Mode == DecodeStrict && length > remaining {
+			return off, fmt.Errorf("run of %v with %v pixels remaining: %w", length, remaining, ErrRunOverflow)
 		}
-		d.updateIndex(pixel)
+		d.updateIndex(d.prev)
+		d.run = length
+		return off, nil
 	}
 	d.prev = pixel
-	return nil
-}
-
-func (d *decoder) nextXY() {
-	width := d.img.Bounds().Dx()
-	if d.x == width-1 {
-		d.x = 0
-		d.y++
-	} else {
-		d.x++
-	}
+	pix[off+0] = pixel.R
+	pix[off+1] = pixel.G
+	pix[off+2] = pixel.B
+	pix[off+3] = pixel.A
+	return off + 4, nil
 }
@@ -2,12 +2,18 @@ package qoi_test
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"image"
 	"image/color"
+	"image/draw"
 	"io"
+	"math"
 	"os"
+	"reflect"
+	"runtime"
 	"testing"
+	"testing/iotest"
 
 	"github.com/kropptrevor/go-qoi/qoi"
 )
@@ -246,6 +252,38 @@ func TestDecode(t *testing.T) {
 		imageEquals(t, expected, actual)
 	})
 
+	t.Run("Should parse RGB chunk keeping previous alpha", func(t *testing.T) {
+		t.Parallel()
+		const width = 2
+		const height = 1
+		expected := image.NewNRGBA(image.Rectangle{
+			Min: image.Point{X: 0, Y: 0},
+			Max: image.Point{X: width, Y: height},
+		})
+		expected.SetNRGBA(0, 0, color.NRGBA{128, 0, 0, 128})
+		expected.SetNRGBA(1, 0, color.NRGBA{0, 128, 0, 128})
+		reader := bytes.NewReader([]byte{
+			'q', 'o', 'i', 'f', 0, 0, 0, width, 0, 0, 0, height, byte(qoi.ChannelsRGBA), qoi.ColorSpaceSRGB,
+			qoi.TagRGBA,
+			128, // red
+			0,   // green
+			0,   // blue
+			128, // alpha
+			qoi.TagRGB,
+			0,   // red
+			128, // green
+			0,   // blue
+			0, 0, 0, 0, 0, 0, 0, 1,
+		})
+
+		actual, err := qoi.Decode(reader)
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+
+		imageEquals(t, expected, actual)
+	})
+
 	t.Run("Should parse index chunk", func(t *testing.T) {
 		t.Parallel()
 		const width = 3
@@ -513,3 +551,949 @@ func TestDecode(t *testing.T) {
 	})
 
 }
+
+func TestDecodeConfig(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Should parse width and height", func(t *testing.T) {
+		t.Parallel()
+		const width = 3
+		const height = 2
+		reader := bytes.NewReader([]byte{
+			'q', 'o', 'i', 'f', 0, 0, 0, width, 0, 0, 0, height, byte(qoi.ChannelsRGBA), qoi.ColorSpaceSRGB,
+		})
+
+		config, err := qoi.DecodeConfig(reader)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		if config.Width != width || config.Height != height {
+			t.Fatalf("expected %vx%v but got %vx%v", width, height, config.Width, config.Height)
+		}
+		if config.ColorModel != color.NRGBAModel {
+			t.Fatalf("expected NRGBA color model but got %v", config.ColorModel)
+		}
+	})
+
+	t.Run("Should fail parsing bad magic bytes", func(t *testing.T) {
+		t.Parallel()
+		reader := bytes.NewReader([]byte{
+			'a', 'b', 'c', 'd', 0, 0, 0, 0, 0, 0, 0, 0, 3, 0,
+		})
+
+		_, err := qoi.DecodeConfig(reader)
+
+		expected := qoi.ErrParseHeader
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should be registered with image package", func(t *testing.T) {
+		t.Parallel()
+		qoiFile, err := os.Open("testdata/10x10.qoi")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer qoiFile.Close()
+
+		config, format, err := image.DecodeConfig(qoiFile)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		if format != "qoi" {
+			t.Fatalf("expected format %q but got %q", "qoi", format)
+		}
+		if config.Width != 10 || config.Height != 10 {
+			t.Fatalf("expected 10x10 but got %vx%v", config.Width, config.Height)
+		}
+	})
+
+	t.Run("Should decode through image package", func(t *testing.T) {
+		t.Parallel()
+		pngFile, err := os.Open("testdata/sample.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pngFile.Close()
+		expected, _, err := image.Decode(pngFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		qoiFile, err := os.Open("testdata/sample.qoi")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer qoiFile.Close()
+
+		actual, format, err := image.Decode(qoiFile)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		if format != "qoi" {
+			t.Fatalf("expected format %q but got %q", "qoi", format)
+		}
+		imageEquals(t, expected, actual)
+	})
+}
+
+func TestReadHeader(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Should parse all header fields", func(t *testing.T) {
+		t.Parallel()
+		expected := qoi.Header{
+			Width:      0x01020304,
+			Height:     0x05060708,
+			Channels:   qoi.ChannelsRGB,
+			ColorSpace: qoi.ColorSpaceLinear,
+		}
+		reader := bytes.NewReader([]byte{
+			'q', 'o', 'i', 'f', 1, 2, 3, 4, 5, 6, 7, 8, byte(qoi.ChannelsRGB), qoi.ColorSpaceLinear,
+		})
+
+		actual, err := qoi.ReadHeader(reader)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		if expected != actual {
+			t.Fatalf("expected %+v but got %+v", expected, actual)
+		}
+	})
+
+	t.Run("Should fail parsing bad channels", func(t *testing.T) {
+		t.Parallel()
+		reader := bytes.NewReader([]byte{
+			'q', 'o', 'i', 'f', 0, 0, 0, 0, 0, 0, 0, 0, 9, qoi.ColorSpaceSRGB,
+		})
+
+		_, err := qoi.ReadHeader(reader)
+
+		expected := qoi.ErrParseHeader
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+}
+
+func TestDecodeWithHeader(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Should return header with image", func(t *testing.T) {
+		t.Parallel()
+		expected := qoi.Header{
+			Width:      1,
+			Height:     1,
+			Channels:   qoi.ChannelsRGB,
+			ColorSpace: qoi.ColorSpaceLinear,
+		}
+		reader := bytes.NewReader([]byte{
+			'q', 'o', 'i', 'f', 0, 0, 0, 1, 0, 0, 0, 1, byte(qoi.ChannelsRGB), qoi.ColorSpaceLinear,
+			qoi.TagRGB, 128, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 1,
+		})
+
+		m, actual, err := qoi.DecodeWithHeader(reader)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		if expected != actual {
+			t.Fatalf("expected %+v but got %+v", expected, actual)
+		}
+		if m.Bounds().Dx() != 1 || m.Bounds().Dy() != 1 {
+			t.Fatalf("expected 1x1 image but got %v", m.Bounds())
+		}
+	})
+}
+
+func TestDecodeWithOptions(t *testing.T) {
+	t.Parallel()
+
+	header := func(width, height uint32) []byte {
+		return []byte{
+			'q', 'o', 'i', 'f',
+			byte(width >> 24), byte(width >> 16), byte(width >> 8), byte(width),
+			byte(height >> 24), byte(height >> 16), byte(height >> 8), byte(height),
+			byte(qoi.ChannelsRGBA), qoi.ColorSpaceSRGB,
+		}
+	}
+
+	t.Run("Should fail with default pixel limit", func(t *testing.T) {
+		t.Parallel()
+		reader := bytes.NewReader(header(math.MaxUint32, math.MaxUint32))
+
+		_, err := qoi.Decode(reader)
+
+		expected := qoi.ErrTooLarge
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should fail with width limit", func(t *testing.T) {
+		t.Parallel()
+		reader := bytes.NewReader(header(11, 10))
+
+		_, err := qoi.DecodeWithOptions(reader, &qoi.DecodeOptions{MaxWidth: 10})
+
+		expected := qoi.ErrTooLarge
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should fail with height limit", func(t *testing.T) {
+		t.Parallel()
+		reader := bytes.NewReader(header(10, 11))
+
+		_, err := qoi.DecodeWithOptions(reader, &qoi.DecodeOptions{MaxHeight: 10})
+
+		expected := qoi.ErrTooLarge
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should fail with pixel limit", func(t *testing.T) {
+		t.Parallel()
+		reader := bytes.NewReader(header(10, 10))
+
+		_, err := qoi.DecodeWithOptions(reader, &qoi.DecodeOptions{MaxPixels: 99})
+
+		expected := qoi.ErrTooLarge
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should decode within limits", func(t *testing.T) {
+		t.Parallel()
+		qoiFile, err := os.ReadFile("testdata/10x10.qoi")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := qoi.Decode(bytes.NewReader(qoiFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual, err := qoi.DecodeWithOptions(bytes.NewReader(qoiFile), &qoi.DecodeOptions{
+			MaxWidth:  10,
+			MaxHeight: 10,
+			MaxPixels: 100,
+		})
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		imageEquals(t, expected, actual)
+	})
+}
+
+func TestDecodeAllocation(t *testing.T) {
+	t.Run("Should not allocate for pixels that never arrive", func(t *testing.T) {
+		const limit = 1 << 20
+		reader := bytes.NewReader([]byte{
+			'q', 'o', 'i', 'f', 0, 0, 0x4e, 0x20, 0, 0, 0x4e, 0x20, byte(qoi.ChannelsRGBA), qoi.ColorSpaceSRGB,
+			qoi.TagRun | 61,
+		})
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+
+		_, err := qoi.Decode(reader)
+
+		runtime.ReadMemStats(&after)
+		if err == nil {
+			t.Fatal("expected non-nil error")
+		}
+		allocated := after.TotalAlloc - before.TotalAlloc
+		if allocated > limit {
+			t.Fatalf("expected at most %v bytes allocated but got %v", limit, allocated)
+		}
+	})
+}
+
+func TestDecodeModes(t *testing.T) {
+	t.Parallel()
+
+	runOverflow := []byte{
+		'q', 'o', 'i', 'f', 0, 0, 0, 2, 0, 0, 0, 1, byte(qoi.ChannelsRGBA), qoi.ColorSpaceSRGB,
+		qoi.TagRun | 0b_000010, // run 3
+		0, 0, 0, 0, 0, 0, 0, 1,
+	}
+	rgbaInRGB := []byte{
+		'q', 'o', 'i', 'f', 0, 0, 0, 1, 0, 0, 0, 1, byte(qoi.ChannelsRGB), qoi.ColorSpaceSRGB,
+		qoi.TagRGBA, 128, 0, 0, 128,
+		0, 0, 0, 0, 0, 0, 0, 1,
+	}
+	trailingData := []byte{
+		'q', 'o', 'i', 'f', 0, 0, 0, 1, 0, 0, 0, 1, byte(qoi.ChannelsRGBA), qoi.ColorSpaceSRGB,
+		qoi.TagRGB, 128, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 1,
+		0,
+	}
+	missingEndMarker := []byte{
+		'q', 'o', 'i', 'f', 0, 0, 0, 1, 0, 0, 0, 1, byte(qoi.ChannelsRGBA), qoi.ColorSpaceSRGB,
+		qoi.TagRGB, 128, 0, 0,
+	}
+
+	tests := []struct {
+		name     string
+		input    []byte
+		mode     qoi.DecodeMode
+		expected error
+	}{
+		{"Should reject run overflow in strict mode", runOverflow, qoi.DecodeStrict, qoi.ErrRunOverflow},
+		{"Should reject RGBA chunk in RGB image in strict mode", rgbaInRGB, qoi.DecodeStrict, qoi.ErrChannelMismatch},
+		{"Should reject trailing data in strict mode", trailingData, qoi.DecodeStrict, qoi.ErrTrailingData},
+		{"Should reject missing end marker in strict mode", missingEndMarker, qoi.DecodeStrict, qoi.ErrParseEndMarker},
+		{"Should accept run overflow by default", runOverflow, qoi.DecodeDefault, nil},
+		{"Should accept RGBA chunk in RGB image by default", rgbaInRGB, qoi.DecodeDefault, nil},
+		{"Should accept trailing data by default", trailingData, qoi.DecodeDefault, nil},
+		{"Should reject missing end marker by default", missingEndMarker, qoi.DecodeDefault, qoi.ErrParseEndMarker},
+		{"Should accept run overflow in lenient mode", runOverflow, qoi.DecodeLenient, nil},
+		{"Should accept RGBA chunk in RGB image in lenient mode", rgbaInRGB, qoi.DecodeLenient, nil},
+		{"Should accept trailing data in lenient mode", trailingData, qoi.DecodeLenient, nil},
+		{"Should accept missing end marker in lenient mode", missingEndMarker, qoi.DecodeLenient, nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			reader := bytes.NewReader(tt.input)
+
+			_, err := qoi.DecodeWithOptions(reader, &qoi.DecodeOptions{Mode: tt.mode})
+
+			if tt.expected == nil && err != nil {
+				t.Fatalf("expected nil error, but got %v", err)
+			}
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("expected %q but got %q", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestDecodePartial(t *testing.T) {
+	t.Parallel()
+
+	truncated := []byte{
+		'q', 'o', 'i', 'f', 0, 0, 0, 2, 0, 0, 0, 3, byte(qoi.ChannelsRGBA), qoi.ColorSpaceSRGB,
+		qoi.TagRGB, 128, 0, 0,
+		qoi.TagRun | 0b_000001, // run 2
+		qoi.TagRGB, 0, 128,
+	}
+
+	t.Run("Should report truncation", func(t *testing.T) {
+		t.Parallel()
+		reader := bytes.NewReader(truncated)
+
+		m, err := qoi.Decode(reader)
+
+		if m != nil {
+			t.Fatalf("expected nil image but got %v", m.Bounds())
+		}
+		expected := qoi.ErrTruncated
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should return partial image", func(t *testing.T) {
+		t.Parallel()
+		expected := image.NewNRGBA(image.Rect(0, 0, 2, 3))
+		expected.SetNRGBA(0, 0, color.NRGBA{128, 0, 0, 255})
+		expected.SetNRGBA(1, 0, color.NRGBA{128, 0, 0, 255})
+		expected.SetNRGBA(0, 1, color.NRGBA{128, 0, 0, 255})
+		reader := bytes.NewReader(truncated)
+
+		actual, err := qoi.DecodeWithOptions(reader, &qoi.DecodeOptions{Partial: true})
+
+		var truncatedErr *qoi.TruncatedError
+		if !errors.As(err, &truncatedErr) {
+			t.Fatalf("expected truncated error but got %v", err)
+		}
+		if truncatedErr.Pixels != 3 || truncatedErr.Rows != 1 {
+			t.Fatalf("expected 3 pixels and 1 row but got %+v", truncatedErr)
+		}
+		imageEquals(t, expected, actual)
+	})
+
+	t.Run("Should recover top of sample", func(t *testing.T) {
+		t.Parallel()
+		data, err := os.ReadFile("testdata/sample.qoi")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := qoi.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader := bytes.NewReader(data[:len(data)/2])
+
+		actual, err := qoi.DecodeWithOptions(reader, &qoi.DecodeOptions{Partial: true})
+
+		var truncatedErr *qoi.TruncatedError
+		if !errors.As(err, &truncatedErr) {
+			t.Fatalf("expected truncated error but got %v", err)
+		}
+		if truncatedErr.Rows == 0 {
+			t.Fatal("expected at least one recovered row")
+		}
+		rect := image.Rect(0, 0, expected.Bounds().Dx(), truncatedErr.Rows)
+		sub := func(m image.Image) image.Image {
+			return m.(*image.NRGBA).SubImage(rect)
+		}
+		imageEquals(t, sub(expected), sub(actual))
+	})
+}
+
+func TestDecodeError(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Should report location of truncated chunk", func(t *testing.T) {
+		t.Parallel()
+		reader := bytes.NewReader([]byte{
+			'q', 'o', 'i', 'f', 0, 0, 0, 2, 0, 0, 0, 2, byte(qoi.ChannelsRGBA), qoi.ColorSpaceSRGB,
+			qoi.TagRGB, 128, 0, 0,
+			qoi.TagDiff | 0b_11_10_10,
+			qoi.TagRun,
+			qoi.TagLuma | 0b_100000,
+		})
+
+		_, err := qoi.Decode(reader)
+
+		var decodeErr *qoi.DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Fatalf("expected decode error but got %v", err)
+		}
+		expected := qoi.DecodeError{
+			Offset: 20,
+			X:      1,
+			Y:      1,
+			Chunk:  qoi.ChunkLuma,
+			Err:    decodeErr.Err,
+		}
+		if expected != *decodeErr {
+			t.Fatalf("expected %+v but got %+v", expected, *decodeErr)
+		}
+		if !errors.Is(err, qoi.ErrTruncated) {
+			t.Fatalf("expected %q but got %q", qoi.ErrTruncated, err)
+		}
+		if errors.Is(err, qoi.ErrCorrupt) {
+			t.Fatalf("expected truncation not to be corruption")
+		}
+	})
+
+	t.Run("Should report truncated header", func(t *testing.T) {
+		t.Parallel()
+		reader := bytes.NewReader([]byte{'q', 'o', 'i', 'f', 0, 0})
+
+		_, err := qoi.Decode(reader)
+
+		if !errors.Is(err, qoi.ErrTruncated) {
+			t.Fatalf("expected %q but got %q", qoi.ErrTruncated, err)
+		}
+	})
+
+	t.Run("Should report corrupt run chunk", func(t *testing.T) {
+		t.Parallel()
+		reader := bytes.NewReader([]byte{
+			'q', 'o', 'i', 'f', 0, 0, 0, 2, 0, 0, 0, 1, byte(qoi.ChannelsRGBA), qoi.ColorSpaceSRGB,
+			qoi.TagRGB, 128, 0, 0,
+			qoi.TagRun | 0b_000001, // run 2
+			0, 0, 0, 0, 0, 0, 0, 1,
+		})
+
+		_, err := qoi.DecodeWithOptions(reader, &qoi.DecodeOptions{Mode: qoi.DecodeStrict})
+
+		var decodeErr *qoi.DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Fatalf("expected decode error but got %v", err)
+		}
+		if decodeErr.Offset != 18 || decodeErr.X != 1 || decodeErr.Y != 0 || decodeErr.Chunk != qoi.ChunkRun {
+			t.Fatalf("expected run chunk at byte 18, pixel (1, 0), but got %v", decodeErr)
+		}
+		if !errors.Is(err, qoi.ErrCorrupt) {
+			t.Fatalf("expected %q but got %q", qoi.ErrCorrupt, err)
+		}
+		if !errors.Is(err, qoi.ErrRunOverflow) {
+			t.Fatalf("expected %q but got %q", qoi.ErrRunOverflow, err)
+		}
+	})
+
+	t.Run("Should report bad end marker location", func(t *testing.T) {
+		t.Parallel()
+		reader := bytes.NewReader([]byte{
+			'q', 'o', 'i', 'f', 0, 0, 0, 1, 0, 0, 0, 1, byte(qoi.ChannelsRGBA), qoi.ColorSpaceSRGB,
+			qoi.TagRGB, 128, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 2,
+		})
+
+		_, err := qoi.Decode(reader)
+
+		var decodeErr *qoi.DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Fatalf("expected decode error but got %v", err)
+		}
+		if decodeErr.Offset != 18 || decodeErr.Chunk != qoi.ChunkNone {
+			t.Fatalf("expected end marker at byte 18 but got %v", decodeErr)
+		}
+		if !errors.Is(err, qoi.ErrCorrupt) {
+			t.Fatalf("expected %q but got %q", qoi.ErrCorrupt, err)
+		}
+	})
+}
+
+func TestDecodeReaders(t *testing.T) {
+	t.Parallel()
+
+	readers := []struct {
+		name string
+		wrap func(io.Reader) io.Reader
+	}{
+		{"one byte reader", iotest.OneByteReader},
+		{"half reader", iotest.HalfReader},
+		{"data error reader", iotest.DataErrReader},
+		{"plain reader", func(r io.Reader) io.Reader { return struct{ io.Reader }{r} }},
+	}
+	for _, tt := range readers {
+		tt := tt
+		t.Run("Should decode sample from "+tt.name, func(t *testing.T) {
+			t.Parallel()
+			data, err := os.ReadFile("testdata/sample.qoi")
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := qoi.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual, err := qoi.Decode(tt.wrap(bytes.NewReader(data)))
+
+			if err != nil {
+				t.Fatalf("expected nil error, but got %v", err)
+			}
+			imageEquals(t, expected, actual)
+		})
+	}
+
+	t.Run("Should return reader error", func(t *testing.T) {
+		t.Parallel()
+		expected := errors.New("read failed")
+		reader := io.MultiReader(
+			bytes.NewReader([]byte{'q', 'o', 'i', 'f', 0, 0, 0, 1}),
+			iotest.ErrReader(expected),
+		)
+
+		_, err := qoi.Decode(reader)
+
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should not read past end marker of byte reader", func(t *testing.T) {
+		t.Parallel()
+		data, err := os.ReadFile("testdata/10x10.qoi")
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader := bytes.NewReader(append(data, 'x'))
+
+		_, err = qoi.Decode(reader)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		if reader.Len() != 1 {
+			t.Fatalf("expected 1 unread byte but got %v", reader.Len())
+		}
+	})
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for name, m := range randomImages(image.Rect(0, 0, 301, 299)) {
+		if _, ok := m.(*image.Uniform); ok {
+			continue
+		}
+		name, m := name, m
+		t.Run("Should round trip "+name, func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			if err := qoi.Encode(&buf, m, qoi.ChannelsRGBA); err != nil {
+				t.Fatal(err)
+			}
+
+			actual, err := qoi.Decode(&buf)
+
+			if err != nil {
+				t.Fatalf("expected nil error, but got %v", err)
+			}
+			imageEquals(t, m, actual)
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	data, err := os.ReadFile("testdata/sample.qoi")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := qoi.Decode(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeFile(b *testing.B) {
+	f, err := os.Open("testdata/sample.qoi")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := qoi.Decode(f); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDecodeInto(t *testing.T) {
+	t.Parallel()
+
+	loadSample := func(t *testing.T) ([]byte, image.Image) {
+		data, err := os.ReadFile("testdata/sample.qoi")
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := qoi.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data, m
+	}
+
+	destinations := map[string]func(image.Rectangle) draw.Image{
+		"NRGBA":   func(r image.Rectangle) draw.Image { return image.NewNRGBA(r) },
+		"RGBA":    func(r image.Rectangle) draw.Image { return image.NewRGBA(r) },
+		"NRGBA64": func(r image.Rectangle) draw.Image { return image.NewNRGBA64(r) },
+	}
+	for name, newImage := range destinations {
+		name, newImage := name, newImage
+		t.Run("Should decode into "+name+" at offset", func(t *testing.T) {
+			t.Parallel()
+			data, m := loadSample(t)
+			size := m.Bounds().Size()
+			at := image.Pt(7, 3)
+			bounds := image.Rect(-5, 0, size.X+20, size.Y+10)
+			expected := newImage(bounds)
+			draw.Draw(expected, image.Rectangle{Min: at, Max: at.Add(size)}, m, image.Point{}, draw.Src)
+			actual := newImage(bounds)
+
+			err := qoi.DecodeInto(bytes.NewReader(data), actual, at)
+
+			if err != nil {
+				t.Fatalf("expected nil error, but got %v", err)
+			}
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				for x := bounds.Min.X; x < bounds.Max.X; x++ {
+					if expected.At(x, y) != actual.At(x, y) {
+						t.Fatalf("expected color %v but got %v at %v", expected.At(x, y), actual.At(x, y), image.Pt(x, y))
+					}
+				}
+			}
+		})
+	}
+
+	t.Run("Should fail with destination too small", func(t *testing.T) {
+		t.Parallel()
+		data, m := loadSample(t)
+		dst := image.NewNRGBA(m.Bounds())
+
+		err := qoi.DecodeInto(bytes.NewReader(data), dst, image.Pt(1, 0))
+
+		expected := qoi.ErrTooSmall
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should decode image without pixels anywhere", func(t *testing.T) {
+		t.Parallel()
+		data := []byte{
+			'q', 'o', 'i', 'f', 0, 0, 0, 0, 0, 0, 0, 5, byte(qoi.ChannelsRGBA), qoi.ColorSpaceSRGB,
+			0, 0, 0, 0, 0, 0, 0, 1,
+		}
+		dst := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+
+		err := qoi.DecodeInto(bytes.NewReader(data), dst, image.Pt(100, 100))
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+	})
+
+	t.Run("Should report truncation", func(t *testing.T) {
+		t.Parallel()
+		data, m := loadSample(t)
+		dst := image.NewRGBA(m.Bounds())
+
+		err := qoi.DecodeInto(bytes.NewReader(data[:len(data)/2]), dst, image.Point{})
+
+		expected := qoi.ErrTruncated
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+}
+
+func BenchmarkDecodeInto(b *testing.B) {
+	data, err := os.ReadFile("testdata/sample.qoi")
+	if err != nil {
+		b.Fatal(err)
+	}
+	config, err := qoi.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		b.Fatal(err)
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, config.Width, config.Height))
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := qoi.DecodeInto(bytes.NewReader(data), dst, image.Point{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Should fail with zero Decoder until Reset", func(t *testing.T) {
+		t.Parallel()
+		expected := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+		var buf bytes.Buffer
+		err := qoi.Encode(&buf, expected, qoi.ChannelsRGBA)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoder qoi.Decoder
+
+		_, err = decoder.Decode()
+
+		if err == nil {
+			t.Fatal("expected non-nil error")
+		}
+		decoder.Reset(&buf)
+		actual, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		imageEquals(t, expected, actual)
+	})
+
+	encode := func(t *testing.T, m image.Image) []byte {
+		var buf bytes.Buffer
+		err := qoi.Encode(&buf, m, qoi.ChannelsRGBA)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	t.Run("Should decode consecutive images from one stream", func(t *testing.T) {
+		t.Parallel()
+		first := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+		first.Pix[5] = 200
+		second := image.NewNRGBA(image.Rect(0, 0, 1, 4))
+		second.Pix[3] = 0
+		stream := append(encode(t, first), encode(t, second)...)
+		decoder := qoi.NewDecoder(iotest.HalfReader(bytes.NewReader(stream)), nil)
+
+		for _, expected := range []image.Image{first, second} {
+			actual, err := decoder.Decode()
+
+			if err != nil {
+				t.Fatalf("expected nil error, but got %v", err)
+			}
+			imageEquals(t, expected, actual)
+		}
+		_, err := decoder.Decode()
+		if !errors.Is(err, qoi.ErrTruncated) {
+			t.Fatalf("expected %q but got %q", qoi.ErrTruncated, err)
+		}
+	})
+
+	t.Run("Should read from new input after Reset", func(t *testing.T) {
+		t.Parallel()
+		first := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+		second := image.NewNRGBA(image.Rect(0, 0, 5, 1))
+		second.Pix[0] = 9
+		decoder := qoi.NewDecoder(iotest.HalfReader(bytes.NewReader(encode(t, first))), nil)
+		_, err := decoder.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoder.Reset(bytes.NewReader(encode(t, second)))
+
+		actual, err := decoder.Decode()
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		imageEquals(t, second, actual)
+		if header := decoder.Header(); header.Width != 5 || header.Height != 1 {
+			t.Fatalf("expected 5x1 header but got %vx%v", header.Width, header.Height)
+		}
+	})
+}
+
+func TestDecoderAllocation(t *testing.T) {
+	t.Run("Should not allocate when decoding into an image", func(t *testing.T) {
+		data, err := os.ReadFile("testdata/sample.qoi")
+		if err != nil {
+			t.Fatal(err)
+		}
+		config, err := qoi.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst := image.NewNRGBA(image.Rect(0, 0, config.Width, config.Height))
+		reader := bytes.NewReader(data)
+		decoder := qoi.NewDecoder(reader, nil)
+
+		allocs := testing.AllocsPerRun(10, func() {
+			reader.Reset(data)
+			decoder.Reset(reader)
+			if err := decoder.DecodeInto(dst, image.Point{}); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		if allocs != 0 {
+			t.Fatalf("expected 0 allocations but got %v", allocs)
+		}
+	})
+}
+
+func TestDecodeBytes(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Should decode the same image as Decode", func(t *testing.T) {
+		t.Parallel()
+		data, err := os.ReadFile("testdata/sample.qoi")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := qoi.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual, err := qoi.DecodeBytes(data)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		imageEquals(t, expected, actual)
+	})
+
+	t.Run("Should report truncation", func(t *testing.T) {
+		t.Parallel()
+		data, err := os.ReadFile("testdata/sample.qoi")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = qoi.DecodeBytes(data[:len(data)/2])
+
+		expected := qoi.ErrTruncated
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+}
+
+func BenchmarkDecodeBytes(b *testing.B) {
+	data, err := os.ReadFile("testdata/sample.qoi")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := qoi.DecodeBytes(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDecodeContext(t *testing.T) {
+	t.Parallel()
+
+	var encoded bytes.Buffer
+	err := qoi.Encode(&encoded, image.NewNRGBA(image.Rect(0, 0, 3, 5)), qoi.ChannelsRGBA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Should report progress for each row", func(t *testing.T) {
+		t.Parallel()
+		var calls [][2]int
+		opts := &qoi.DecodeOptions{Progress: func(rows, total int) {
+			calls = append(calls, [2]int{rows, total})
+		}}
+
+		_, err := qoi.DecodeContext(context.Background(), bytes.NewReader(encoded.Bytes()), opts)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		expected := [][2]int{{1, 5}, {2, 5}, {3, 5}, {4, 5}, {5, 5}}
+		if !reflect.DeepEqual(expected, calls) {
+			t.Fatalf("expected calls %v but got %v", expected, calls)
+		}
+	})
+
+	t.Run("Should stop when canceled", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		rows := 0
+		opts := &qoi.DecodeOptions{Progress: func(done, total int) {
+			rows = done
+			if done == 3 {
+				cancel()
+			}
+		}}
+
+		_, err := qoi.DecodeContext(ctx, bytes.NewReader(encoded.Bytes()), opts)
+
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected %q but got %q", context.Canceled, err)
+		}
+		if rows != 3 {
+			t.Fatalf("expected 3 rows but got %v", rows)
+		}
+	})
+}
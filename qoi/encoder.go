@@ -1,62 +1,336 @@
 package qoi
 
 import (
-	"encoding/binary"
+	"context"
+	"errors"
+	"fmt"
 	"image"
 	"image/color"
 	"io"
+	"math"
 )
 
+var ErrInvalidChannels = errors.New("invalid channels")
+
+var ErrInvalidColorSpace = errors.New("invalid color space")
+
+var ErrInvalidRegion = errors.New("invalid region")
+
+var errNoWriter = errors.New("encoder has no writer, use NewEncoder or Reset")
+
+// AlphaPolicy controls what happens to pixels that are not fully opaque
+// when the header declares ChannelsRGB.
+type AlphaPolicy uint8
+
+const (
+	// AlphaKeep writes such pixels unchanged as RGBA chunks.
+	AlphaKeep AlphaPolicy = iota
+	// AlphaError fails the encode with ErrChannelMismatch.
+	AlphaError
+	// AlphaFlatten composites every pixel onto Options.Background, so the
+	// encoded image is fully opaque regardless of the header channels.
+	AlphaFlatten
+)
+
+// Options configures EncodeWithOptions. The zero value selects
+// ChannelsAuto and ColorSpaceSRGB.
+type Options struct {
+	Channels   Channels
+	ColorSpace uint8
+	Alpha      AlphaPolicy
+	// Background is the color used by AlphaFlatten. Its alpha is ignored.
+	// A nil Background is black.
+	Background color.Color
+	// Progress, if not nil, is called after each encoded row.
+	Progress ProgressFunc
+	// Reduction selects how components of images with more than 8 bits
+	// per component are reduced to 8 bits.
+	Reduction Reduction
+}
+
+func (o *Options) validate(rect image.Rectangle) error {
+	if o.Channels != ChannelsAuto && o.Channels != ChannelsRGB && o.Channels != ChannelsRGBA {
+		return fmt.Errorf("bad channels %v: %w", o.Channels, ErrInvalidChannels)
+	}
+	if o.ColorSpace != ColorSpaceSRGB && o.ColorSpace != ColorSpaceLinear {
+		return fmt.Errorf("bad color space %v: %w", o.ColorSpace, ErrInvalidColorSpace)
+	}
+	size := rect.Size()
+	if uint64(size.X) > math.MaxUint32 || uint64(size.Y) > math.MaxUint32 {
+		return fmt.Errorf("size %v exceeds header limits: %w", size, ErrTooLarge)
+	}
+	return nil
+}
+
 func Encode(w io.Writer, m image.Image, ch Channels) error {
-	e := encoder{
-		binWriter: binaryWriterErr{writer: w},
-		channels:  ch,
-		image:     m,
-		prev:      rgba{0, 0, 0, 255},
+	return EncodeWithOptions(w, m, &Options{Channels: ch})
+}
+
+func EncodeWithOptions(w io.Writer, m image.Image, opts *Options) error {
+	return EncodeRegion(w, m, m.Bounds(), opts)
+}
+
+func EncodeRegion(w io.Writer, m image.Image, rect image.Rectangle, opts *Options) error {
+	return NewEncoder(w, opts).EncodeRegion(m, rect)
+}
+
+// EncodeContext is like EncodeWithOptions but stops with the error of ctx
+// once ctx is done. ctx is checked before each row.
+func EncodeContext(ctx context.Context, w io.Writer, m image.Image, opts *Options) error {
+	e := NewEncoder(w, opts)
+	e.ctx = ctx
+	return e.Encode(m)
+}
+
+// AppendEncode appends the QOI encoding of m to dst and returns the extended
+// slice. On error dst is returned unchanged.
+func AppendEncode(dst []byte, m image.Image, opts *Options) ([]byte, error) {
+	e := newEncoder(opts)
+	e.out.buf = dst
+	e.out.appendOnly = true
+	err := e.Encode(m)
+	if err != nil {
+		return dst, err
+	}
+	return e.out.buf, nil
+}
+
+const (
+	headerSize    = 14
+	endMarkerSize = 8
+)
+
+// MaxEncodedLen returns the maximum length of the QOI encoding of a width by
+// height image with the given channels, or -1 if the size is invalid or
+// overflows an int. ChannelsAuto is treated as ChannelsRGBA. For ChannelsRGB
+// the result assumes every pixel is opaque, which holds unless the image is
+// encoded with AlphaKeep.
+func MaxEncodedLen(width, height int, ch Channels) int {
+	switch ch {
+	case ChannelsAuto:
+		ch = ChannelsRGBA
+	case ChannelsRGB, ChannelsRGBA:
+	default:
+		return -1
+	}
+	if width < 0 || height < 0 || uint64(width) > math.MaxUint32 || uint64(height) > math.MaxUint32 {
+		return -1
+	}
+	chunkSize := uint64(ch) + 1
+	pixels := uint64(width) * uint64(height)
+	if pixels > (math.MaxInt-headerSize-endMarkerSize)/chunkSize {
+		return -1
+	}
+	return headerSize + int(pixels*chunkSize) + endMarkerSize
+}
+
+// Encoder writes QOI images to an io.Writer. Its buffers are kept between
+// images, so reusing an Encoder, for example through a sync.Pool, avoids
+// allocating for each image. An Encoder must not be used concurrently.
+// Create one with NewEncoder; a zero Encoder fails to encode until Reset
+// gives it a writer.
+type Encoder struct {
+	ctx        context.Context
+	out        writer
+	opts       Options
+	background rgba
+	channels   Channels
+	rect       image.Rectangle
+	src        source
+	row        []rgba
+	wide       []color.NRGBA64
+	diffusion  [2][]int32
+	rows       int
+	cache      [64]rgba
+	prev       rgba
+	runLength  byte
+}
+
+func NewEncoder(w io.Writer, opts *Options) *Encoder {
+	e := newEncoder(opts)
+	e.out = newWriter(w)
+	return e
+}
+
+// newEncoder returns an Encoder without output. It fails to encode until a
+// destination is set or its writer is made append-only.
+func newEncoder(opts *Options) *Encoder {
+	e := &Encoder{}
+	if opts != nil {
+		e.opts = *opts
+	}
+	if e.opts.Background != nil {
+		e.background = newRGBA(e.opts.Background)
+	}
+	e.background.A = 255
+	return e
+}
+
+// Reset discards any error and buffered output and makes e write to w,
+// keeping its options and buffers.
+func (e *Encoder) Reset(w io.Writer) {
+	e.out.reset(w)
+}
+
+func (e *Encoder) Encode(m image.Image) error {
+	return e.EncodeRegion(m, m.Bounds())
+}
+
+func (e *Encoder) EncodeRegion(m image.Image, rect image.Rectangle) error {
+	if !rect.In(m.Bounds()) {
+		return fmt.Errorf("region %v outside bounds %v: %w", rect, m.Bounds(), ErrInvalidRegion)
+	}
+	e.src.reset(m, rect)
+	return e.encode(rect)
+}
+
+// encode writes the rect region of e.src.
+func (e *Encoder) encode(rect image.Rectangle) error {
+	defer e.src.clear()
+	err := e.opts.validate(rect)
+	if err != nil {
+		return err
+	}
+	if e.out.err != nil {
+		return e.out.err
+	}
+	if e.out.dst == nil && !e.out.appendOnly {
+		return errNoWriter
+	}
+	// A failed encode can leave part of its image unflushed.
+	if !e.out.appendOnly {
+		e.out.buf = e.out.buf[:0]
+	}
+
+	e.start(rect)
+	if e.channels == ChannelsAuto {
+		e.channels = e.detectChannels()
 	}
 
 	e.writeHeader()
-	if e.binWriter.err != nil {
-		return e.binWriter.err
+	if e.out.err != nil {
+		return e.out.err
 	}
 
-	for y := 0; y < m.Bounds().Dy(); y++ {
-		for x := 0; x < m.Bounds().Dx(); x++ {
-			e.writeChunk(x, y)
-			if e.binWriter.err != nil {
-				return e.binWriter.err
+	err = e.encodeRows(rect.Min.Y, rect.Max.Y)
+	if err != nil {
+		return err
+	}
+	return e.finish()
+}
+
+// encodeRows writes the chunks for rows minY to maxY of e.src, carrying the
+// run and cache state over from earlier rows.
+func (e *Encoder) encodeRows(minY, maxY int) error {
+	for y := minY; y < maxY; y++ {
+		err := checkContext(e.ctx)
+		if err != nil {
+			return err
+		}
+		e.readRow(y)
+		for i, pixel := range e.row {
+			pixel = e.applyAlpha(pixel)
+			if pixel.A != 255 && e.channels == ChannelsRGB && e.opts.Alpha == AlphaError {
+				return fmt.Errorf("pixel %v has alpha %v: %w", image.Point{e.src.rect.Min.X + i, y}, pixel.A, ErrChannelMismatch)
 			}
+			e.writeChunk(pixel)
+		}
+		if e.out.err != nil {
+			return e.out.err
+		}
+		e.rows++
+		if e.opts.Progress != nil {
+			e.opts.Progress(e.rows, e.rect.Dy())
 		}
 	}
+	return nil
+}
 
+// finish ends any pending run, writes the end marker and flushes.
+func (e *Encoder) finish() error {
 	if e.runLength > 0 {
 		e.writeRunChunk()
 	}
 
 	e.writeEndMarker()
-	if e.binWriter.err != nil {
-		return e.binWriter.err
+	e.out.flush()
+	return e.out.err
+}
+
+func (e *Encoder) start(rect image.Rectangle) {
+	e.channels = e.opts.Channels
+	e.rect = rect
+	width := rect.Dx()
+	if cap(e.row) < width {
+		e.row = make([]rgba, width)
+	}
+	e.row = e.row[:width]
+	if e.opts.Reduction != ReduceTruncate && e.src.wide() {
+		e.startReduction(width)
+	} else {
+		e.wide = e.wide[:0]
 	}
+	e.rows = 0
+	e.cache = [64]rgba{}
+	e.prev = rgba{0, 0, 0, 255}
+	e.runLength = 0
+}
 
-	return nil
+const writerBufferSize = 4096
+
+// writer collects output in buf and writes it to dst whenever the buffer
+// fills up. The first error from dst is kept and stops further writes. An
+// append-only writer has no dst and only appends to buf.
+type writer struct {
+	dst        io.Writer
+	buf        []byte
+	err        error
+	appendOnly bool
+}
+
+func newWriter(dst io.Writer) writer {
+	return writer{
+		dst: dst,
+		buf: make([]byte, 0, writerBufferSize),
+	}
 }
 
-type binaryWriterErr struct {
-	writer io.Writer
-	err    error
+func (w *writer) reset(dst io.Writer) {
+	w.dst = dst
+	w.buf = w.buf[:0]
+	w.err = nil
 }
 
-func (b *binaryWriterErr) write(data any) {
-	if b == nil {
+func (w *writer) flush() {
+	if w.dst == nil || w.err != nil || len(w.buf) == 0 {
 		return
 	}
+	n, err := w.dst.Write(w.buf)
+	if err == nil && n < len(w.buf) {
+		err = io.ErrShortWrite
+	}
+	w.err = err
+	w.buf = w.buf[:0]
+}
 
-	err := binary.Write(b.writer, binary.BigEndian, data)
-	if err != nil {
-		b.err = err
+func (w *writer) writeByte(b byte) {
+	w.buf = append(w.buf, b)
+	if len(w.buf) >= writerBufferSize {
+		w.flush()
 	}
 }
 
+func (w *writer) writeBytes(bs ...byte) {
+	w.buf = append(w.buf, bs...)
+	if len(w.buf) >= writerBufferSize {
+		w.flush()
+	}
+}
+
+func (w *writer) writeUint32(v uint32) {
+	w.writeBytes(byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
 func newRGBA(c color.Color) rgba {
 	c = color.NRGBAModel.Convert(c)
 	nrgba, ok := c.(color.NRGBA)
@@ -72,35 +346,75 @@ func newRGBA(c color.Color) rgba {
 	}
 }
 
-type encoder struct {
-	binWriter binaryWriterErr
-	channels  Channels
-	image     image.Image
-	cache     [64]rgba
-	prev      rgba
-	runLength byte
+func (e *Encoder) detectChannels() Channels {
+	if e.opts.Alpha == AlphaFlatten {
+		return ChannelsRGB
+	}
+
+	m := e.src.image
+	if m == nil && !e.src.layout.hasAlpha() {
+		return ChannelsRGB
+	}
+	if o, ok := m.(interface{ Opaque() bool }); ok && e.rect == m.Bounds() {
+		if o.Opaque() {
+			return ChannelsRGB
+		}
+		return ChannelsRGBA
+	}
+
+	// Rows are read like the encoded ones, so that the channels match the
+	// alpha after reduction. Reading them moves the dithering state on, so
+	// it is reset afterwards.
+	if len(e.wide) > 0 {
+		defer e.startReduction(e.rect.Dx())
+	}
+	for y := e.rect.Min.Y; y < e.rect.Max.Y; y++ {
+		e.readRow(y)
+		for _, pixel := range e.row {
+			if pixel.A != 255 {
+				return ChannelsRGBA
+			}
+		}
+	}
+	return ChannelsRGB
+}
+
+func (e *Encoder) applyAlpha(pixel rgba) rgba {
+	if e.opts.Alpha != AlphaFlatten || pixel.A == 255 {
+		return pixel
+	}
+
+	a := uint32(pixel.A)
+	blend := func(c, bg byte) byte {
+		return byte((uint32(c)*a + uint32(bg)*(255-a) + 127) / 255)
+	}
+	return rgba{
+		R: blend(pixel.R, e.background.R),
+		G: blend(pixel.G, e.background.G),
+		B: blend(pixel.B, e.background.B),
+		A: 255,
+	}
 }
 
-func (e *encoder) writeHeader() {
-	e.binWriter.write([]byte("qoif"))
+func (e *Encoder) writeHeader() {
+	e.out.writeBytes('q', 'o', 'i', 'f')
 
-	rect := e.image.Bounds()
-	width := uint32(rect.Dx())
-	e.binWriter.write(width)
+	width := uint32(e.rect.Dx())
+	e.out.writeUint32(width)
 
-	height := uint32(rect.Dy())
-	e.binWriter.write(height)
+	height := uint32(e.rect.Dy())
+	e.out.writeUint32(height)
 
-	e.binWriter.write(e.channels)
+	e.out.writeByte(byte(e.channels))
 
-	e.binWriter.write(ColorSpaceSRGB)
+	e.out.writeByte(e.opts.ColorSpace)
 }
 
-func (e *encoder) isNewRun(next rgba) bool {
+func (e *Encoder) isNewRun(next rgba) bool {
 	return e.runLength == 0 && e.prev == next
 }
 
-func (e *encoder) canLengthenRun(next rgba) bool {
+func (e *Encoder) canLengthenRun(next rgba) bool {
 	return e.runLength > 0 && e.prev == next && e.runLength <= 61
 }
 
@@ -126,8 +440,7 @@ func isSmallLumaDiff(dg, drdg, dbdg byte) bool {
 	return dg <= 63 && drdg <= 15 && dbdg <= 15
 }
 
-func (e *encoder) writeChunk(x, y int) {
-	pixel := newRGBA(e.image.At(x, y))
+func (e *Encoder) writeChunk(pixel rgba) {
 	index := pixel.index()
 	cachePixel := e.cache[index]
 
@@ -138,12 +451,9 @@ func (e *encoder) writeChunk(x, y int) {
 
 	case e.runLength > 0:
 		e.writeRunChunk()
-		if e.binWriter.err != nil {
-			return
-		}
 
 		e.runLength = 0
-		e.writeChunk(x, y)
+		e.writeChunk(pixel)
 		return
 
 	case pixel == cachePixel:
@@ -174,49 +484,41 @@ func (e *encoder) writeChunk(x, y int) {
 	e.prev = pixel
 }
 
-func (e *encoder) writeRGBChunk(pixel rgba) {
-	e.binWriter.write(TagRGB)
-	e.binWriter.write(pixel.R)
-	e.binWriter.write(pixel.G)
-	e.binWriter.write(pixel.B)
+func (e *Encoder) writeRGBChunk(pixel rgba) {
+	e.out.writeBytes(TagRGB, pixel.R, pixel.G, pixel.B)
 }
 
-func (e *encoder) writeRGBAChunk(pixel rgba) {
-	e.binWriter.write(TagRGBA)
-	e.binWriter.write(pixel.R)
-	e.binWriter.write(pixel.G)
-	e.binWriter.write(pixel.B)
-	e.binWriter.write(pixel.A)
+func (e *Encoder) writeRGBAChunk(pixel rgba) {
+	e.out.writeBytes(TagRGBA, pixel.R, pixel.G, pixel.B, pixel.A)
 }
 
-func (e *encoder) writeIndexChunk(index int) {
-	e.binWriter.write(byte(index))
+func (e *Encoder) writeIndexChunk(index int) {
+	e.out.writeByte(byte(index))
 }
 
-func (e *encoder) writeDiffChunk(dr byte, dg byte, db byte) {
+func (e *Encoder) writeDiffChunk(dr byte, dg byte, db byte) {
 	chunk := TagDiff
 	chunk |= dr << 4
 	chunk |= dg << 2
 	chunk |= db
-	e.binWriter.write(chunk)
+	e.out.writeByte(chunk)
 }
 
-func (e *encoder) writeLumaChunk(dg byte, drdg byte, dbdg byte) {
+func (e *Encoder) writeLumaChunk(dg byte, drdg byte, dbdg byte) {
 	first := TagLuma
 	first |= dg
-	e.binWriter.write(first)
 	second := byte(0)
 	second |= drdg << 4
 	second |= dbdg
-	e.binWriter.write(second)
+	e.out.writeBytes(first, second)
 }
 
-func (e *encoder) writeRunChunk() {
+func (e *Encoder) writeRunChunk() {
 	chunk := TagRun
 	chunk |= e.runLength - 1
-	e.binWriter.write(chunk)
+	e.out.writeByte(chunk)
 }
 
-func (e *encoder) writeEndMarker() {
-	e.binWriter.write([]byte{0, 0, 0, 0, 0, 0, 0, 1})
+func (e *Encoder) writeEndMarker() {
+	e.out.writeBytes(0, 0, 0, 0, 0, 0, 0, 1)
 }
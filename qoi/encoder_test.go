@@ -2,12 +2,17 @@ package qoi_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"image"
 	"image/color"
 	"io"
+	"math"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
 	"testing"
 
 	_ "image/png"
@@ -414,3 +419,727 @@ func TestEncode(t *testing.T) {
 	})
 
 }
+
+func TestEncodeWithOptions(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Should write color space", func(t *testing.T) {
+		t.Parallel()
+		expected := qoi.ColorSpaceLinear
+		image := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		var buf bytes.Buffer
+
+		err := qoi.EncodeWithOptions(&buf, image, &qoi.Options{
+			Channels:   qoi.ChannelsRGBA,
+			ColorSpace: qoi.ColorSpaceLinear,
+		})
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		actual := buf.Bytes()[13]
+		if expected != actual {
+			t.Fatalf("expected %v but got %v", expected, actual)
+		}
+	})
+
+	t.Run("Should use defaults for nil options", func(t *testing.T) {
+		t.Parallel()
+		image := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		var expected bytes.Buffer
+		if err := qoi.Encode(&expected, image, qoi.ChannelsRGBA); err != nil {
+			t.Fatal(err)
+		}
+		var actual bytes.Buffer
+
+		err := qoi.EncodeWithOptions(&actual, image, nil)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		if !bytes.Equal(expected.Bytes(), actual.Bytes()) {
+			t.Fatalf("expected %08b, but got %08b", expected.Bytes(), actual.Bytes())
+		}
+	})
+
+	t.Run("Should fail with invalid channels", func(t *testing.T) {
+		t.Parallel()
+		image := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		var buf bytes.Buffer
+
+		err := qoi.Encode(&buf, image, 7)
+
+		expected := qoi.ErrInvalidChannels
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+		if buf.Len() != 0 {
+			t.Fatalf("expected nothing written but got %v bytes", buf.Len())
+		}
+	})
+
+	t.Run("Should fail with invalid color space", func(t *testing.T) {
+		t.Parallel()
+		image := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		var buf bytes.Buffer
+
+		err := qoi.EncodeWithOptions(&buf, image, &qoi.Options{
+			Channels:   qoi.ChannelsRGBA,
+			ColorSpace: 2,
+		})
+
+		expected := qoi.ErrInvalidColorSpace
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should fail with image too large", func(t *testing.T) {
+		t.Parallel()
+		if strconv.IntSize == 32 {
+			t.Skip("image size cannot exceed header limits on 32-bit platforms")
+		}
+		width := int64(math.MaxUint32) + 1
+		image := &image.NRGBA{Rect: image.Rect(0, 0, int(width), 1)}
+		var buf bytes.Buffer
+
+		err := qoi.Encode(&buf, image, qoi.ChannelsRGBA)
+
+		expected := qoi.ErrTooLarge
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should fail with translucent pixel when alpha policy is error", func(t *testing.T) {
+		t.Parallel()
+		image := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		image.SetNRGBA(5, 5, color.NRGBA{0, 0, 0, 255})
+		image.SetNRGBA(6, 5, color.NRGBA{0, 0, 0, 128})
+		var buf bytes.Buffer
+
+		err := qoi.EncodeWithOptions(&buf, image, &qoi.Options{
+			Channels: qoi.ChannelsRGB,
+			Alpha:    qoi.AlphaError,
+		})
+
+		expected := qoi.ErrChannelMismatch
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should keep translucent pixel when alpha policy is keep", func(t *testing.T) {
+		t.Parallel()
+		expected := []byte{qoi.TagRGBA, 0, 0, 0, 128}
+		image := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		image.SetNRGBA(0, 0, color.NRGBA{0, 0, 0, 128})
+		var buf bytes.Buffer
+
+		err := qoi.EncodeWithOptions(&buf, image, &qoi.Options{
+			Channels: qoi.ChannelsRGB,
+			Alpha:    qoi.AlphaKeep,
+		})
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		actual := buf.Bytes()[14:19]
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("expected %08b, but got %08b", expected, actual)
+		}
+	})
+}
+
+func TestEncodeChannelsAuto(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Should detect RGB for opaque image", func(t *testing.T) {
+		t.Parallel()
+		expected := byte(qoi.ChannelsRGB)
+		image := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		for i := range image.Pix {
+			image.Pix[i] = 255
+		}
+		var buf bytes.Buffer
+
+		err := qoi.Encode(&buf, image, qoi.ChannelsAuto)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		actual := buf.Bytes()[12]
+		if expected != actual {
+			t.Fatalf("expected %v but got %v", expected, actual)
+		}
+	})
+
+	t.Run("Should detect RGBA for translucent image", func(t *testing.T) {
+		t.Parallel()
+		expected := byte(qoi.ChannelsRGBA)
+		image := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		var buf bytes.Buffer
+
+		err := qoi.Encode(&buf, image, qoi.ChannelsAuto)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		actual := buf.Bytes()[12]
+		if expected != actual {
+			t.Fatalf("expected %v but got %v", expected, actual)
+		}
+	})
+
+	t.Run("Should detect RGBA by scanning image without Opaque method", func(t *testing.T) {
+		t.Parallel()
+		expected := byte(qoi.ChannelsRGBA)
+		m := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		for i := range m.Pix {
+			m.Pix[i] = 255
+		}
+		m.SetNRGBA(9, 9, color.NRGBA{0, 0, 0, 0})
+		var buf bytes.Buffer
+
+		err := qoi.Encode(&buf, struct{ image.Image }{m}, qoi.ChannelsAuto)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		actual := buf.Bytes()[12]
+		if expected != actual {
+			t.Fatalf("expected %v but got %v", expected, actual)
+		}
+	})
+}
+
+func TestEncodeAlphaFlatten(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Should composite onto background", func(t *testing.T) {
+		t.Parallel()
+		expected := []byte{
+			byte(qoi.ChannelsRGB), qoi.ColorSpaceSRGB,
+			qoi.TagRGB, 128, 0, 127,
+		}
+		image := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		image.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 128})
+		var buf bytes.Buffer
+
+		err := qoi.EncodeWithOptions(&buf, image, &qoi.Options{
+			Alpha:      qoi.AlphaFlatten,
+			Background: color.NRGBA{0, 0, 255, 255},
+		})
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		actual := buf.Bytes()[12:18]
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("expected %v, but got %v", expected, actual)
+		}
+	})
+
+	t.Run("Should write only opaque pixels", func(t *testing.T) {
+		t.Parallel()
+		pngFile, err := os.Open("testdata/sample.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pngFile.Close()
+		m, _, err := image.Decode(pngFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+
+		err = qoi.EncodeWithOptions(&buf, m, &qoi.Options{
+			Channels:   qoi.ChannelsRGB,
+			Alpha:      qoi.AlphaFlatten,
+			Background: color.White,
+		})
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		decoded, err := qoi.Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !decoded.(interface{ Opaque() bool }).Opaque() {
+			t.Fatal("expected opaque image")
+		}
+	})
+}
+
+func TestEncodeRegion(t *testing.T) {
+	t.Parallel()
+
+	newSample := func(t *testing.T) image.Image {
+		pngFile, err := os.Open("testdata/sample.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pngFile.Close()
+		m, _, err := image.Decode(pngFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	crop := func(m image.Image, rect image.Rectangle) *image.NRGBA {
+		dst := image.NewNRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				dst.Set(x-rect.Min.X, y-rect.Min.Y, m.At(x, y))
+			}
+		}
+		return dst
+	}
+
+	t.Run("Should encode sub image bounds", func(t *testing.T) {
+		t.Parallel()
+		m := newSample(t)
+		rect := image.Rect(10, 20, 110, 90)
+		var expected bytes.Buffer
+		if err := qoi.Encode(&expected, crop(m, rect), qoi.ChannelsRGBA); err != nil {
+			t.Fatal(err)
+		}
+		sub := m.(interface {
+			SubImage(image.Rectangle) image.Image
+		}).SubImage(rect)
+		var actual bytes.Buffer
+
+		err := qoi.Encode(&actual, sub, qoi.ChannelsRGBA)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		if !bytes.Equal(expected.Bytes(), actual.Bytes()) {
+			t.Fatal("expected sub image to encode like a cropped copy")
+		}
+	})
+
+	t.Run("Should encode region", func(t *testing.T) {
+		t.Parallel()
+		m := newSample(t)
+		rect := image.Rect(5, 7, 64, 33)
+		var expected bytes.Buffer
+		if err := qoi.Encode(&expected, crop(m, rect), qoi.ChannelsRGBA); err != nil {
+			t.Fatal(err)
+		}
+		var actual bytes.Buffer
+
+		err := qoi.EncodeRegion(&actual, m, rect, &qoi.Options{Channels: qoi.ChannelsRGBA})
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		if !bytes.Equal(expected.Bytes(), actual.Bytes()) {
+			t.Fatal("expected region to encode like a cropped copy")
+		}
+	})
+
+	t.Run("Should fail with region outside bounds", func(t *testing.T) {
+		t.Parallel()
+		m := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		var buf bytes.Buffer
+
+		err := qoi.EncodeRegion(&buf, m, image.Rect(5, 5, 15, 15), nil)
+
+		expected := qoi.ErrInvalidRegion
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should encode empty region outside bounds", func(t *testing.T) {
+		t.Parallel()
+		m := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		var buf bytes.Buffer
+
+		err := qoi.EncodeRegion(&buf, m, image.Rect(1000, 1000, 1000, 1005), nil)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		header, err := qoi.ReadHeader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Width != 0 || header.Height != 5 {
+			t.Fatalf("expected 0x5 but got %dx%d", header.Width, header.Height)
+		}
+	})
+}
+
+type failingWriter struct {
+	err     error
+	limit   int
+	writes  int
+	written int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.written+len(p) > w.limit {
+		return 0, w.err
+	}
+	w.written += len(p)
+	return len(p), nil
+}
+
+func TestEncodeWriter(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Should return writer error", func(t *testing.T) {
+		t.Parallel()
+		m := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+		for i := range m.Pix {
+			m.Pix[i] = byte(i)
+		}
+		expected := errors.New("write failed")
+		w := &failingWriter{err: expected, limit: 100}
+
+		err := qoi.Encode(w, m, qoi.ChannelsRGBA)
+
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should fail on short write", func(t *testing.T) {
+		t.Parallel()
+		m := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		w := &failingWriter{limit: 10}
+
+		err := qoi.Encode(w, m, qoi.ChannelsRGBA)
+
+		expected := io.ErrShortWrite
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should buffer small writes", func(t *testing.T) {
+		t.Parallel()
+		m := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		for i := range m.Pix {
+			m.Pix[i] = byte(i)
+		}
+		w := &failingWriter{limit: math.MaxInt}
+
+		err := qoi.Encode(w, m, qoi.ChannelsRGBA)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		if w.writes != 1 {
+			t.Fatalf("expected 1 write but got %v", w.writes)
+		}
+	})
+}
+
+func loadSample(tb testing.TB) image.Image {
+	pngFile, err := os.Open("testdata/sample.png")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer pngFile.Close()
+	m, _, err := image.Decode(pngFile)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return m
+}
+
+func TestEncoder(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Should fail with zero Encoder until Reset", func(t *testing.T) {
+		t.Parallel()
+		m := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+		var encoder qoi.Encoder
+
+		err := encoder.Encode(m)
+
+		if err == nil {
+			t.Fatal("expected non-nil error")
+		}
+		var buf bytes.Buffer
+		encoder.Reset(&buf)
+		err = encoder.Encode(m)
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		if buf.Len() == 0 {
+			t.Fatal("expected output after Reset")
+		}
+	})
+
+	t.Run("Should match Encode after Reset", func(t *testing.T) {
+		t.Parallel()
+		images := []image.Image{
+			loadSample(t),
+			image.NewNRGBA(image.Rect(0, 0, 3, 5)),
+			image.NewGray(image.Rect(0, 0, 70, 1)),
+		}
+		encoder := qoi.NewEncoder(io.Discard, &qoi.Options{Channels: qoi.ChannelsRGBA})
+
+		for _, m := range images {
+			var expected, actual bytes.Buffer
+			err := qoi.Encode(&expected, m, qoi.ChannelsRGBA)
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoder.Reset(&actual)
+
+			err = encoder.Encode(m)
+
+			if err != nil {
+				t.Fatalf("expected nil error, but got %v", err)
+			}
+			if !bytes.Equal(expected.Bytes(), actual.Bytes()) {
+				t.Fatalf("expected %v bytes but got %v different bytes", expected.Len(), actual.Len())
+			}
+		}
+	})
+
+	t.Run("Should encode after a failed encode", func(t *testing.T) {
+		t.Parallel()
+		translucent := image.NewNRGBA(image.Rect(0, 0, 3, 3))
+		translucent.Pix[len(translucent.Pix)-1] = 255
+		expected := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+		copy(expected.Pix, []byte{1, 2, 3, 255, 4, 5, 6, 255})
+		var buf bytes.Buffer
+		encoder := qoi.NewEncoder(&buf, &qoi.Options{Channels: qoi.ChannelsRGB, Alpha: qoi.AlphaError})
+		err := encoder.Encode(translucent)
+		if !errors.Is(err, qoi.ErrChannelMismatch) {
+			t.Fatalf("expected %q but got %q", qoi.ErrChannelMismatch, err)
+		}
+
+		err = encoder.Encode(expected)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		actual, err := qoi.Decode(&buf)
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		imageEquals(t, expected, actual)
+	})
+
+	t.Run("Should clear write error on Reset", func(t *testing.T) {
+		t.Parallel()
+		m := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+		encoder := qoi.NewEncoder(&failingWriter{err: io.ErrClosedPipe}, nil)
+		err := encoder.Encode(m)
+		if err == nil {
+			t.Fatal("expected non-nil error")
+		}
+		encoder.Reset(io.Discard)
+
+		err = encoder.Encode(m)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+	})
+}
+
+func TestEncoderAllocation(t *testing.T) {
+	t.Run("Should not allocate when reused", func(t *testing.T) {
+		m := loadSample(t)
+		encoder := qoi.NewEncoder(io.Discard, nil)
+
+		allocs := testing.AllocsPerRun(10, func() {
+			encoder.Reset(io.Discard)
+			if err := encoder.Encode(m); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		if allocs != 0 {
+			t.Fatalf("expected 0 allocations but got %v", allocs)
+		}
+	})
+}
+
+func BenchmarkEncode(b *testing.B) {
+	m := loadSample(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := qoi.Encode(io.Discard, m, qoi.ChannelsRGBA); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeFile(b *testing.B) {
+	m := loadSample(b)
+	f, err := os.Create(filepath.Join(b.TempDir(), "sample.qoi"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			b.Fatal(err)
+		}
+		if err := qoi.Encode(f, m, qoi.ChannelsRGBA); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestAppendEncode(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Should append the same bytes as Encode", func(t *testing.T) {
+		t.Parallel()
+		m := loadSample(t)
+		var expected bytes.Buffer
+		expected.WriteString("prefix")
+		err := qoi.EncodeWithOptions(&expected, m, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual, err := qoi.AppendEncode([]byte("prefix"), m, nil)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		if !bytes.Equal(expected.Bytes(), actual) {
+			t.Fatalf("expected %v bytes but got %v different bytes", expected.Len(), len(actual))
+		}
+	})
+
+	t.Run("Should return dst unchanged on error", func(t *testing.T) {
+		t.Parallel()
+		m := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+		dst := []byte("prefix")
+
+		actual, err := qoi.AppendEncode(dst, m, &qoi.Options{Channels: 5})
+
+		expected := qoi.ErrInvalidChannels
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+		if string(actual) != "prefix" {
+			t.Fatalf("expected %q but got %q", "prefix", actual)
+		}
+	})
+}
+
+func TestMaxEncodedLen(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Should bound the encoding of noise", func(t *testing.T) {
+		t.Parallel()
+		m := image.NewNRGBA(image.Rect(0, 0, 17, 9))
+		for i := range m.Pix {
+			m.Pix[i] = byte(i * 131 >> 2)
+		}
+
+		encoded, err := qoi.AppendEncode(nil, m, nil)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		max := qoi.MaxEncodedLen(17, 9, qoi.ChannelsAuto)
+		if len(encoded) > max {
+			t.Fatalf("expected at most %v bytes but got %v", max, len(encoded))
+		}
+	})
+
+	cases := []struct {
+		name          string
+		width, height int
+		channels      qoi.Channels
+		expected      int
+	}{
+		{"empty", 0, 0, qoi.ChannelsRGB, 22},
+		{"RGB", 3, 2, qoi.ChannelsRGB, 22 + 6*4},
+		{"RGBA", 3, 2, qoi.ChannelsRGBA, 22 + 6*5},
+		{"bad channels", 3, 2, 2, -1},
+		{"negative", -1, 2, qoi.ChannelsRGB, -1},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run("Should handle "+c.name, func(t *testing.T) {
+			t.Parallel()
+
+			actual := qoi.MaxEncodedLen(c.width, c.height, c.channels)
+
+			if actual != c.expected {
+				t.Fatalf("expected %v but got %v", c.expected, actual)
+			}
+		})
+	}
+}
+
+func BenchmarkAppendEncode(b *testing.B) {
+	m := loadSample(b)
+	var dst []byte
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var err error
+		dst, err = qoi.AppendEncode(dst[:0], m, &qoi.Options{Channels: qoi.ChannelsRGBA})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestEncodeContext(t *testing.T) {
+	t.Parallel()
+
+	m := image.NewNRGBA(image.Rect(0, 0, 4, 6))
+
+	t.Run("Should report progress for each row", func(t *testing.T) {
+		t.Parallel()
+		var calls [][2]int
+		opts := &qoi.Options{Progress: func(rows, total int) {
+			calls = append(calls, [2]int{rows, total})
+		}}
+
+		err := qoi.EncodeContext(context.Background(), io.Discard, m, opts)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		expected := [][2]int{{1, 6}, {2, 6}, {3, 6}, {4, 6}, {5, 6}, {6, 6}}
+		if !reflect.DeepEqual(expected, calls) {
+			t.Fatalf("expected calls %v but got %v", expected, calls)
+		}
+	})
+
+	t.Run("Should stop when canceled", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		rows := 0
+		opts := &qoi.Options{Progress: func(done, total int) {
+			rows = done
+			if done == 2 {
+				cancel()
+			}
+		}}
+
+		err := qoi.EncodeContext(ctx, io.Discard, m, opts)
+
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected %q but got %q", context.Canceled, err)
+		}
+		if rows != 2 {
+			t.Fatalf("expected 2 rows but got %v", rows)
+		}
+	})
+}
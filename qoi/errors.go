@@ -0,0 +1,109 @@
+package qoi
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrCorrupt = errors.New("corrupt QOI data")
+
+var ErrTruncated = errors.New("truncated QOI data")
+
+// TruncatedError reports how much of the image was decoded before the
+// stream ended.
+type TruncatedError struct {
+	Pixels int
+	Rows   int
+}
+
+func (e *TruncatedError) Error() string {
+	return fmt.Sprintf("%v after %v pixels and %v complete rows", ErrTruncated, e.Pixels, e.Rows)
+}
+
+func (e *TruncatedError) Unwrap() error {
+	return ErrTruncated
+}
+
+type ChunkKind uint8
+
+const (
+	ChunkNone ChunkKind = iota
+	ChunkRGB
+	ChunkRGBA
+	ChunkIndex
+	ChunkDiff
+	ChunkLuma
+	ChunkRun
+)
+
+func chunkKind(tag byte) ChunkKind {
+	switch {
+	case tag == TagRGB:
+		return ChunkRGB
+	case tag == TagRGBA:
+		return ChunkRGBA
+	case tag&TagMask == TagIndex:
+		return ChunkIndex
+	case tag&TagMask == TagDiff:
+		return ChunkDiff
+	case tag&TagMask == TagLuma:
+		return ChunkLuma
+	default:
+		return ChunkRun
+	}
+}
+
+func (k ChunkKind) String() string {
+	switch k {
+	case ChunkRGB:
+		return "RGB"
+	case ChunkRGBA:
+		return "RGBA"
+	case ChunkIndex:
+		return "index"
+	case ChunkDiff:
+		return "diff"
+	case ChunkLuma:
+		return "luma"
+	case ChunkRun:
+		return "run"
+	default:
+		return "none"
+	}
+}
+
+// DecodeError describes where in the stream decoding failed. Offset is the
+// position of the first byte of the chunk, header or end marker being
+// parsed, and X and Y are the coordinates of the next pixel to decode.
+type DecodeError struct {
+	Offset int64
+	X      int
+	Y      int
+	Chunk  ChunkKind
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Chunk == ChunkNone {
+		return fmt.Sprintf("%v at byte %v, pixel (%v, %v)", e.Err, e.Offset, e.X, e.Y)
+	}
+	return fmt.Sprintf("%v at byte %v, pixel (%v, %v), %v chunk", e.Err, e.Offset, e.X, e.Y, e.Chunk)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the wrapped error means the data does not conform to
+// the QOI format, in which case the error also matches ErrCorrupt.
+func (e *DecodeError) Is(target error) bool {
+	if target != ErrCorrupt {
+		return false
+	}
+	for _, err := range []error{ErrParseHeader, ErrParseEndMarker, ErrRunOverflow, ErrChannelMismatch, ErrTrailingData} {
+		if errors.Is(e.Err, err) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package qoi
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+)
+
+var ErrTooManyColors = errors.New("too many colors for a palette")
+
+// OutputType selects the image type returned by decoding.
+type OutputType uint8
+
+const (
+	// OutputNRGBA returns *image.NRGBA.
+	OutputNRGBA OutputType = iota
+	// OutputRGBA returns *image.RGBA with premultiplied alpha.
+	OutputRGBA
+	// OutputGray returns *image.Gray, converting colors with
+	// color.GrayModel.
+	OutputGray
+	// OutputPaletted returns *image.Paletted with the colors in order of
+	// first appearance. Images with more than 256 colors fail with
+	// ErrTooManyColors.
+	OutputPaletted
+	// OutputAuto returns the most compact type that holds the image
+	// exactly: *image.Gray for opaque gray images, then *image.Paletted
+	// for up to 256 colors, then *image.RGBA for opaque images and
+	// *image.NRGBA otherwise.
+	OutputAuto
+)
+
+// convert returns m as the requested type. m may be modified.
+func convert(m *image.NRGBA, output OutputType) (image.Image, error) {
+	switch output {
+	case OutputNRGBA:
+		return m, nil
+
+	case OutputRGBA:
+		premultiply(m.Pix)
+		return &image.RGBA{Pix: m.Pix, Stride: m.Stride, Rect: m.Rect}, nil
+
+	case OutputGray:
+		return toGray(m), nil
+
+	case OutputPaletted:
+		p, ok := toPaletted(m)
+		if !ok {
+			return nil, fmt.Errorf("more than %v colors: %w", 256, ErrTooManyColors)
+		}
+		return p, nil
+
+	case OutputAuto:
+		if isOpaqueGray(m.Pix) {
+			return toGray(m), nil
+		}
+		if p, ok := toPaletted(m); ok {
+			return p, nil
+		}
+		if m.Opaque() {
+			return convert(m, OutputRGBA)
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("bad output type %v", output)
+}
+
+func isOpaqueGray(pix []byte) bool {
+	for i := 0; i < len(pix); i += 4 {
+		if pix[i] != pix[i+1] || pix[i] != pix[i+2] || pix[i+3] != 255 {
+			return false
+		}
+	}
+	return true
+}
+
+func toGray(m *image.NRGBA) *image.Gray {
+	gray := image.NewGray(m.Rect)
+	for i := range gray.Pix {
+		r, g, b, a := m.Pix[4*i], m.Pix[4*i+1], m.Pix[4*i+2], m.Pix[4*i+3]
+		switch {
+		case r == g && g == b && a == 255:
+			gray.Pix[i] = r
+		case a == 255:
+			// Same weights as color.GrayModel, on 16-bit components.
+			y := (19595*uint32(r) + 38470*uint32(g) + 7471*uint32(b)) * 0x101
+			gray.Pix[i] = byte((y + 1<<15) >> 24)
+		default:
+			gray.Pix[i] = color.GrayModel.Convert(color.NRGBA{r, g, b, a}).(color.Gray).Y
+		}
+	}
+	return gray
+}
+
+// toPaletted returns m as a paletted image, or false if it has more than
+// 256 colors.
+func toPaletted(m *image.NRGBA) (*image.Paletted, bool) {
+	indices := make(map[rgba]uint8)
+	palette := color.Palette{}
+	pix := make([]byte, len(m.Pix)/4)
+	var last rgba
+	var lastIndex uint8
+	for i := range pix {
+		c := rgba{m.Pix[4*i], m.Pix[4*i+1], m.Pix[4*i+2], m.Pix[4*i+3]}
+		if i > 0 && c == last {
+			pix[i] = lastIndex
+			continue
+		}
+		index, ok := indices[c]
+		if !ok {
+			if len(palette) == 256 {
+				return nil, false
+			}
+			index = uint8(len(palette))
+			indices[c] = index
+			palette = append(palette, color.NRGBA(c))
+		}
+		pix[i] = index
+		last, lastIndex = c, index
+	}
+	return &image.Paletted{
+		Pix:     pix,
+		Stride:  m.Rect.Dx(),
+		Rect:    m.Rect,
+		Palette: palette,
+	}, true
+}
@@ -0,0 +1,124 @@
+package qoi_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+
+	"github.com/kropptrevor/go-qoi/qoi"
+)
+
+func decodeAs(t *testing.T, m image.Image, output qoi.OutputType) (image.Image, error) {
+	var buf bytes.Buffer
+	err := qoi.Encode(&buf, m, qoi.ChannelsAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return qoi.DecodeWithOptions(&buf, &qoi.DecodeOptions{Output: output})
+}
+
+func TestDecodeOutput(t *testing.T) {
+	t.Parallel()
+
+	rect := image.Rect(0, 0, 30, 20)
+	random := randomImages(rect)["NRGBA"].(*image.NRGBA)
+	opaque := image.NewNRGBA(rect)
+	copy(opaque.Pix, random.Pix)
+	for i := 3; i < len(opaque.Pix); i += 4 {
+		opaque.Pix[i] = 255
+	}
+	gray := randomImages(rect)["Gray"]
+	few := image.NewNRGBA(rect)
+	for i := range few.Pix {
+		few.Pix[i] = byte(i % 7 * 40)
+	}
+
+	models := map[qoi.OutputType]color.Model{
+		qoi.OutputNRGBA: color.NRGBAModel,
+		qoi.OutputRGBA:  color.RGBAModel,
+		qoi.OutputGray:  color.GrayModel,
+	}
+	types := map[qoi.OutputType]reflect.Type{
+		qoi.OutputNRGBA: reflect.TypeOf(&image.NRGBA{}),
+		qoi.OutputRGBA:  reflect.TypeOf(&image.RGBA{}),
+		qoi.OutputGray:  reflect.TypeOf(&image.Gray{}),
+	}
+	for output, model := range models {
+		output, model := output, model
+		t.Run("Should convert with "+types[output].String()+" color model", func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := decodeAs(t, random, output)
+
+			if err != nil {
+				t.Fatalf("expected nil error, but got %v", err)
+			}
+			if reflect.TypeOf(actual) != types[output] {
+				t.Fatalf("expected %v but got %T", types[output], actual)
+			}
+			for y := rect.Min.Y; y < rect.Max.Y; y++ {
+				for x := rect.Min.X; x < rect.Max.X; x++ {
+					expected := model.Convert(random.At(x, y))
+					if actual.At(x, y) != expected {
+						t.Fatalf("expected color %v but got %v at %v", expected, actual.At(x, y), image.Pt(x, y))
+					}
+				}
+			}
+		})
+	}
+
+	t.Run("Should decode few colors as Paletted", func(t *testing.T) {
+		t.Parallel()
+
+		actual, err := decodeAs(t, few, qoi.OutputPaletted)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		if _, ok := actual.(*image.Paletted); !ok {
+			t.Fatalf("expected *image.Paletted but got %T", actual)
+		}
+		imageEquals(t, few, actual)
+	})
+
+	t.Run("Should fail Paletted with too many colors", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := decodeAs(t, random, qoi.OutputPaletted)
+
+		expected := qoi.ErrTooManyColors
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	auto := []struct {
+		name     string
+		m        image.Image
+		expected reflect.Type
+	}{
+		{"gray", gray, reflect.TypeOf(&image.Gray{})},
+		{"few colors", few, reflect.TypeOf(&image.Paletted{})},
+		{"opaque", opaque, reflect.TypeOf(&image.RGBA{})},
+		{"transparent", random, reflect.TypeOf(&image.NRGBA{})},
+	}
+	for _, c := range auto {
+		c := c
+		t.Run("Should pick "+c.expected.String()+" for "+c.name+" image", func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := decodeAs(t, c.m, qoi.OutputAuto)
+
+			if err != nil {
+				t.Fatalf("expected nil error, but got %v", err)
+			}
+			if reflect.TypeOf(actual) != c.expected {
+				t.Fatalf("expected %v but got %T", c.expected, actual)
+			}
+			imageEquals(t, c.m, actual)
+		})
+	}
+}
@@ -1,10 +1,15 @@
 package qoi
 
-import "image/color"
+import (
+	"context"
+	"errors"
+	"image/color"
+)
 
 type Channels uint8
 
 const (
+	ChannelsAuto     Channels = 0
 	ChannelsRGB      Channels = 3
 	ChannelsRGBA     Channels = 4
 	ColorSpaceSRGB   uint8    = 0
@@ -21,6 +26,30 @@ const (
 	TagRun   byte = 0b11_000000
 )
 
+var ErrTooLarge = errors.New("image too large")
+
+var ErrChannelMismatch = errors.New("pixel data does not match channels")
+
+type Header struct {
+	Width      uint32
+	Height     uint32
+	Channels   Channels
+	ColorSpace uint8
+}
+
+// ProgressFunc is called after each row with the number of rows done and
+// the total number of rows.
+type ProgressFunc func(rows, total int)
+
+// checkContext returns the error of ctx once it is done. A nil ctx is never
+// done.
+func checkContext(ctx context.Context) error {
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Err()
+}
+
 type rgba color.NRGBA
 
 func (color rgba) index() int {
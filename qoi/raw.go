@@ -0,0 +1,151 @@
+package qoi
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+)
+
+var ErrInvalidLayout = errors.New("invalid pixel layout")
+
+var ErrShortBuffer = errors.New("pixel buffer too short")
+
+// PixelLayout is the byte order of a pixel in a raw buffer. Each component
+// takes one byte. Colors are not premultiplied by alpha.
+type PixelLayout uint8
+
+const (
+	LayoutRGBA PixelLayout = iota
+	LayoutBGRA
+	LayoutARGB
+	LayoutRGB
+	LayoutBGR
+)
+
+func (l PixelLayout) String() string {
+	switch l {
+	case LayoutRGBA:
+		return "RGBA"
+	case LayoutBGRA:
+		return "BGRA"
+	case LayoutARGB:
+		return "ARGB"
+	case LayoutRGB:
+		return "RGB"
+	case LayoutBGR:
+		return "BGR"
+	}
+	return fmt.Sprintf("PixelLayout(%d)", uint8(l))
+}
+
+// BytesPerPixel returns the size of one pixel, or 0 for an invalid layout.
+func (l PixelLayout) BytesPerPixel() int {
+	switch l {
+	case LayoutRGBA, LayoutBGRA, LayoutARGB:
+		return 4
+	case LayoutRGB, LayoutBGR:
+		return 3
+	}
+	return 0
+}
+
+func (l PixelLayout) hasAlpha() bool {
+	return l.BytesPerPixel() == 4
+}
+
+// EncodeRaw encodes a width by height image stored in pix with the given
+// layout. Rows start stride bytes apart.
+func EncodeRaw(w io.Writer, pix []byte, width, height, stride int, layout PixelLayout, opts *Options) error {
+	return NewEncoder(w, opts).EncodeRaw(pix, width, height, stride, layout)
+}
+
+func (e *Encoder) EncodeRaw(pix []byte, width, height, stride int, layout PixelLayout) error {
+	bpp := layout.BytesPerPixel()
+	if bpp == 0 {
+		return fmt.Errorf("bad layout %v: %w", layout, ErrInvalidLayout)
+	}
+	if width < 0 || height < 0 {
+		return fmt.Errorf("negative size %vx%v: %w", width, height, ErrInvalidRegion)
+	}
+	if width > 0 && height > 0 {
+		// The sizes are compared without multiplying them out, which could
+		// overflow.
+		if width > len(pix)/bpp {
+			return fmt.Errorf("%v bytes for %vx%v %v pixels: %w", len(pix), width, height, layout, ErrShortBuffer)
+		}
+		rowSize := width * bpp
+		if stride < rowSize {
+			return fmt.Errorf("stride %v below row size %v: %w", stride, rowSize, ErrShortBuffer)
+		}
+		if height > 1 && stride > (len(pix)-rowSize)/(height-1) {
+			return fmt.Errorf("%v bytes for %vx%v %v pixels: %w", len(pix), width, height, layout, ErrShortBuffer)
+		}
+	}
+
+	e.src.resetRaw(pix, width, height, stride, layout)
+	return e.encode(image.Rect(0, 0, width, height))
+}
+
+// DecodeRaw decodes an image into a new buffer with the given layout and a
+// stride of width times layout.BytesPerPixel(). Alpha is dropped for
+// layouts without it.
+func DecodeRaw(r io.Reader, layout PixelLayout) ([]byte, Header, error) {
+	d := NewDecoder(r, nil)
+	pix, err := d.DecodeRaw(layout)
+	if err != nil {
+		return nil, Header{}, err
+	}
+	return pix, d.Header(), nil
+}
+
+func (d *Decoder) DecodeRaw(layout PixelLayout) ([]byte, error) {
+	if layout.BytesPerPixel() == 0 {
+		return nil, fmt.Errorf("bad layout %v: %w", layout, ErrInvalidLayout)
+	}
+	_, err := d.start()
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.parseChunks()
+	if err != nil {
+		return nil, d.wrapErr(err)
+	}
+
+	err = d.finish()
+	if err != nil {
+		return nil, err
+	}
+
+	d.convertColorSpace(d.pix)
+	return swizzle(d.pix, layout), nil
+}
+
+// swizzle converts RGBA pixels to layout and returns them. 4-byte layouts
+// are converted in place; 3-byte layouts get a new buffer of their own size.
+func swizzle(pix []byte, layout PixelLayout) []byte {
+	switch layout {
+	case LayoutBGRA:
+		for i := 0; i+3 < len(pix); i += 4 {
+			pix[i], pix[i+2] = pix[i+2], pix[i]
+		}
+
+	case LayoutARGB:
+		for i := 0; i+3 < len(pix); i += 4 {
+			pix[i], pix[i+1], pix[i+2], pix[i+3] = pix[i+3], pix[i], pix[i+1], pix[i+2]
+		}
+
+	case LayoutRGB, LayoutBGR:
+		out := make([]byte, len(pix)/4*3)
+		for i, n := 0, 0; n < len(out); i, n = i+4, n+3 {
+			r, g, b := pix[i], pix[i+1], pix[i+2]
+			if layout == LayoutBGR {
+				r, b = b, r
+			}
+			out[n], out[n+1], out[n+2] = r, g, b
+		}
+		return out
+	}
+	return pix
+}
@@ -0,0 +1,162 @@
+package qoi_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/kropptrevor/go-qoi/qoi"
+)
+
+// toLayout converts the pixels of m to layout with the given row padding.
+func toLayout(m *image.NRGBA, layout qoi.PixelLayout, padding int) []byte {
+	size := m.Bounds().Size()
+	stride := size.X*layout.BytesPerPixel() + padding
+	pix := make([]byte, 0, stride*size.Y)
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			c := m.NRGBAAt(x, y)
+			switch layout {
+			case qoi.LayoutRGBA:
+				pix = append(pix, c.R, c.G, c.B, c.A)
+			case qoi.LayoutBGRA:
+				pix = append(pix, c.B, c.G, c.R, c.A)
+			case qoi.LayoutARGB:
+				pix = append(pix, c.A, c.R, c.G, c.B)
+			case qoi.LayoutRGB:
+				pix = append(pix, c.R, c.G, c.B)
+			case qoi.LayoutBGR:
+				pix = append(pix, c.B, c.G, c.R)
+			}
+		}
+		pix = append(pix, make([]byte, padding)...)
+	}
+	return pix
+}
+
+var layouts = []qoi.PixelLayout{
+	qoi.LayoutRGBA,
+	qoi.LayoutBGRA,
+	qoi.LayoutARGB,
+	qoi.LayoutRGB,
+	qoi.LayoutBGR,
+}
+
+func TestEncodeRaw(t *testing.T) {
+	t.Parallel()
+
+	m := randomImages(image.Rect(0, 0, 23, 17))["NRGBA"].(*image.NRGBA)
+	for _, layout := range layouts {
+		layout := layout
+		t.Run("Should encode "+layout.String()+" like NRGBA", func(t *testing.T) {
+			t.Parallel()
+			expectedImage := image.Image(m)
+			if layout.BytesPerPixel() == 3 {
+				opaque := image.NewNRGBA(m.Rect)
+				copy(opaque.Pix, m.Pix)
+				for i := 3; i < len(opaque.Pix); i += 4 {
+					opaque.Pix[i] = 255
+				}
+				expectedImage = opaque
+			}
+			var expected bytes.Buffer
+			err := qoi.Encode(&expected, expectedImage, qoi.ChannelsAuto)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pix := toLayout(m, layout, 5)
+			stride := len(pix) / 17
+			var actual bytes.Buffer
+
+			err = qoi.EncodeRaw(&actual, pix[:len(pix)-5], 23, 17, stride, layout, nil)
+
+			if err != nil {
+				t.Fatalf("expected nil error, but got %v", err)
+			}
+			if !bytes.Equal(expected.Bytes(), actual.Bytes()) {
+				t.Fatal("expected raw output to match NRGBA output")
+			}
+		})
+	}
+
+	t.Run("Should fail with short buffer", func(t *testing.T) {
+		t.Parallel()
+
+		err := qoi.EncodeRaw(&bytes.Buffer{}, make([]byte, 4*4*3-1), 4, 3, 4*4, qoi.LayoutRGBA, nil)
+
+		expected := qoi.ErrShortBuffer
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should fail with overflowing stride", func(t *testing.T) {
+		t.Parallel()
+
+		err := qoi.EncodeRaw(io.Discard, make([]byte, 64), 2, 3, math.MaxInt/2+1, qoi.LayoutRGBA, nil)
+
+		expected := qoi.ErrShortBuffer
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should fail with invalid layout", func(t *testing.T) {
+		t.Parallel()
+
+		err := qoi.EncodeRaw(&bytes.Buffer{}, make([]byte, 16), 2, 2, 8, qoi.PixelLayout(9), nil)
+
+		expected := qoi.ErrInvalidLayout
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+}
+
+func TestDecodeRaw(t *testing.T) {
+	t.Parallel()
+
+	m := randomImages(image.Rect(0, 0, 19, 11))["NRGBA"].(*image.NRGBA)
+	var encoded bytes.Buffer
+	err := qoi.Encode(&encoded, m, qoi.ChannelsRGBA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, layout := range layouts {
+		layout := layout
+		t.Run("Should decode "+layout.String(), func(t *testing.T) {
+			t.Parallel()
+			expected := toLayout(m, layout, 0)
+
+			actual, header, err := qoi.DecodeRaw(bytes.NewReader(encoded.Bytes()), layout)
+
+			if err != nil {
+				t.Fatalf("expected nil error, but got %v", err)
+			}
+			if header.Width != 19 || header.Height != 11 {
+				t.Fatalf("expected 19x11 header but got %vx%v", header.Width, header.Height)
+			}
+			if !bytes.Equal(expected, actual) {
+				t.Fatal("expected decoded pixels to match")
+			}
+			if cap(actual) != len(actual) {
+				t.Fatalf("expected capacity %v but got %v", len(actual), cap(actual))
+			}
+		})
+	}
+
+	t.Run("Should report truncation", func(t *testing.T) {
+		t.Parallel()
+		data := encoded.Bytes()
+
+		_, _, err := qoi.DecodeRaw(bytes.NewReader(data[:len(data)/2]), qoi.LayoutBGRA)
+
+		expected := qoi.ErrTruncated
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+}
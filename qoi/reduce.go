@@ -0,0 +1,165 @@
+package qoi
+
+import (
+	"image"
+	"image/color"
+)
+
+// Reduction selects how 16-bit components are reduced to 8 bits. It applies
+// to images whose color model is color.NRGBA64Model, color.RGBA64Model,
+// color.Gray16Model or color.Alpha16Model, and to *image.Uniform holding a
+// color of those models. Other images are read as before. Dithering applies
+// to the color components; alpha is rounded.
+type Reduction uint8
+
+const (
+	// ReduceTruncate drops the low bits, like color.NRGBAModel.
+	ReduceTruncate Reduction = iota
+	// ReduceRound rounds to the nearest 8-bit value.
+	ReduceRound
+	// ReduceOrdered dithers with a 4x4 Bayer matrix.
+	ReduceOrdered
+	// ReduceFloydSteinberg dithers by Floyd–Steinberg error diffusion.
+	ReduceFloydSteinberg
+)
+
+var bayer4 = [4][4]uint32{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+func (e *Encoder) startReduction(width int) {
+	if cap(e.wide) < width {
+		e.wide = make([]color.NRGBA64, width)
+	}
+	e.wide = e.wide[:width]
+	if e.opts.Reduction != ReduceFloydSteinberg {
+		return
+	}
+	// Errors are kept for each color component with a padding pixel on
+	// either side, so that diffusion needs no bounds checks.
+	size := (width + 2) * 3
+	for i := range e.diffusion {
+		if cap(e.diffusion[i]) < size {
+			e.diffusion[i] = make([]int32, size)
+		}
+		e.diffusion[i] = e.diffusion[i][:size]
+		for j := range e.diffusion[i] {
+			e.diffusion[i][j] = 0
+		}
+	}
+}
+
+// readRow stores row y of the source in e.row, reducing wide components
+// when a reduction was set up by start.
+func (e *Encoder) readRow(y int) {
+	// Rows of an empty region may lie outside the image.
+	if len(e.row) == 0 {
+		return
+	}
+	if len(e.wide) == 0 {
+		e.src.readRow(y, e.row)
+		return
+	}
+
+	e.src.readWideRow(y, e.wide)
+	switch e.opts.Reduction {
+	case ReduceRound:
+		for i, c := range e.wide {
+			e.row[i] = rgba{round8(c.R), round8(c.G), round8(c.B), round8(c.A)}
+		}
+
+	case ReduceOrdered:
+		for i, c := range e.wide {
+			b := bayer4[y&3][(e.rect.Min.X+i)&3]
+			e.row[i] = rgba{ordered8(c.R, b), ordered8(c.G, b), ordered8(c.B, b), round8(c.A)}
+		}
+
+	case ReduceFloydSteinberg:
+		e.diffuseRow()
+	}
+}
+
+func round8(c uint16) byte {
+	return byte((uint32(c)*255 + 0xffff/2) / 0xffff)
+}
+
+// ordered8 reduces c with threshold b of 16.
+func ordered8(c uint16, b uint32) byte {
+	return byte((uint32(c)*255 + (2*b+1)*0xffff/32) / 0xffff)
+}
+
+// diffuseRow reduces e.wide into e.row, spreading each rounding error over
+// the neighbouring pixels that are yet to be reduced. Errors are in units of
+// 1/0xffff of an 8-bit step, scaled by 16.
+func (e *Encoder) diffuseRow() {
+	cur, next := e.diffusion[0], e.diffusion[1]
+	for i := range next {
+		next[i] = 0
+	}
+	for i, c := range e.wide {
+		var out [3]byte
+		for ch, v := range [3]uint16{c.R, c.G, c.B} {
+			j := (i+1)*3 + ch
+			want := int32(v)*255 + cur[j]/16
+			q := (want + 0xffff/2) / 0xffff
+			if q < 0 {
+				q = 0
+			} else if q > 255 {
+				q = 255
+			}
+			diff := want - q*0xffff
+			cur[j+3] += diff * 7
+			next[j-3] += diff * 3
+			next[j] += diff * 5
+			next[j+3] += diff
+			out[ch] = byte(q)
+		}
+		e.row[i] = rgba{out[0], out[1], out[2], round8(c.A)}
+	}
+	e.diffusion[0], e.diffusion[1] = next, cur
+}
+
+// wide reports whether the source has 16 bits per component.
+func (s *source) wide() bool {
+	switch m := s.image.(type) {
+	case nil:
+		return false
+	case *image.Uniform:
+		switch m.C.(type) {
+		case color.NRGBA64, color.RGBA64, color.Gray16, color.Alpha16:
+			return true
+		}
+		return false
+	}
+	switch s.image.ColorModel() {
+	case color.NRGBA64Model, color.RGBA64Model, color.Gray16Model, color.Alpha16Model:
+		return true
+	}
+	return false
+}
+
+// readWideRow stores the pixels of row y of the region in row with 16 bits
+// per component.
+func (s *source) readWideRow(y int, row []color.NRGBA64) {
+	switch m := s.image.(type) {
+	case *image.NRGBA64:
+		pix := m.Pix[m.PixOffset(s.rect.Min.X, y):]
+		for i := range row {
+			p := pix[8*i : 8*i+8]
+			row[i] = color.NRGBA64{
+				R: uint16(p[0])<<8 | uint16(p[1]),
+				G: uint16(p[2])<<8 | uint16(p[3]),
+				B: uint16(p[4])<<8 | uint16(p[5]),
+				A: uint16(p[6])<<8 | uint16(p[7]),
+			}
+		}
+
+	default:
+		for i := range row {
+			row[i] = color.NRGBA64Model.Convert(m.At(s.rect.Min.X+i, y)).(color.NRGBA64)
+		}
+	}
+}
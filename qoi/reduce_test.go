@@ -0,0 +1,190 @@
+package qoi_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"strconv"
+	"testing"
+
+	"github.com/kropptrevor/go-qoi/qoi"
+)
+
+func encodeReduced(t *testing.T, m image.Image, reduction qoi.Reduction) *image.NRGBA {
+	var buf bytes.Buffer
+	err := qoi.EncodeWithOptions(&buf, m, &qoi.Options{Reduction: reduction})
+	if err != nil {
+		t.Fatalf("expected nil error, but got %v", err)
+	}
+	decoded, err := qoi.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoded.(*image.NRGBA)
+}
+
+func TestEncodeReduction(t *testing.T) {
+	t.Parallel()
+
+	// 25850/257 is 100.58, which truncates to 100 and rounds to 101.
+	const level = 25850
+	flat := func(rect image.Rectangle) *image.NRGBA64 {
+		m := image.NewNRGBA64(rect)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				m.SetNRGBA64(x, y, color.NRGBA64{level, level, level, 0xffff})
+			}
+		}
+		return m
+	}
+
+	t.Run("Should truncate by default", func(t *testing.T) {
+		t.Parallel()
+		m := flat(image.Rect(0, 0, 4, 4))
+
+		actual := encodeReduced(t, m, qoi.ReduceTruncate)
+
+		imageEquals(t, m, actual)
+		if actual.Pix[0] != 100 {
+			t.Fatalf("expected 100 but got %v", actual.Pix[0])
+		}
+	})
+
+	rect := image.Rect(0, 0, 4, 4)
+	rgba64 := image.NewRGBA64(rect)
+	gray16 := image.NewGray16(rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			rgba64.SetRGBA64(x, y, color.RGBA64{level, level, level, 0xffff})
+			gray16.SetGray16(x, y, color.Gray16{level})
+		}
+	}
+	sources := map[string]image.Image{
+		"NRGBA64": flat(rect),
+		"RGBA64":  rgba64,
+		"Gray16":  gray16,
+	}
+	for name, m := range sources {
+		name, m := name, m
+		t.Run("Should round "+name, func(t *testing.T) {
+			t.Parallel()
+
+			actual := encodeReduced(t, m, qoi.ReduceRound)
+
+			for i, c := range actual.Pix {
+				expected := byte(101)
+				if i%4 == 3 {
+					expected = 255
+				}
+				if c != expected {
+					t.Fatalf("expected %v but got %v at byte %v", expected, c, i)
+				}
+			}
+		})
+	}
+
+	t.Run("Should round Uniform with 16-bit color", func(t *testing.T) {
+		t.Parallel()
+		m := image.NewUniform(color.NRGBA64{level, level, level, 0xffff})
+		var buf bytes.Buffer
+		opts := &qoi.Options{Reduction: qoi.ReduceRound}
+		err := qoi.EncodeRegion(&buf, m, image.Rect(0, 0, 2, 2), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual, err := qoi.Decode(&buf)
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		if r := actual.(*image.NRGBA).Pix[0]; r != 101 {
+			t.Fatalf("expected 101 but got %v", r)
+		}
+	})
+
+	eightBit := map[string]image.Image{
+		"CMYK":    image.NewCMYK(rect),
+		"NYCbCrA": image.NewNYCbCrA(rect, image.YCbCrSubsampleRatio444),
+	}
+	for name, m := range eightBit {
+		name, m := name, m
+		t.Run("Should not reduce "+name, func(t *testing.T) {
+			t.Parallel()
+			if cmyk, ok := m.(*image.CMYK); ok {
+				for i := range cmyk.Pix {
+					cmyk.Pix[i] = byte(i * 37)
+				}
+			}
+			if ycbcr, ok := m.(*image.NYCbCrA); ok {
+				for i := range ycbcr.Y {
+					ycbcr.Y[i], ycbcr.Cb[i], ycbcr.Cr[i], ycbcr.A[i] = byte(i*37), byte(i*53), byte(i*71), byte(i*89)
+				}
+			}
+			expected := encodeReduced(t, m, qoi.ReduceTruncate)
+
+			actual := encodeReduced(t, m, qoi.ReduceRound)
+
+			if !bytes.Equal(expected.Pix, actual.Pix) {
+				t.Fatalf("expected %v but got %v", expected.Pix, actual.Pix)
+			}
+		})
+	}
+
+	dithers := map[string]qoi.Reduction{
+		"ordered":         qoi.ReduceOrdered,
+		"Floyd–Steinberg": qoi.ReduceFloydSteinberg,
+	}
+	for name, reduction := range dithers {
+		reduction := reduction
+		t.Run("Should dither to the average level with "+name+" dithering", func(t *testing.T) {
+			t.Parallel()
+			m := flat(image.Rect(-3, 2, 61, 66))
+
+			actual := encodeReduced(t, m, reduction)
+
+			sum := 0
+			for i, c := range actual.Pix {
+				if i%4 == 3 {
+					continue
+				}
+				if c != 100 && c != 101 {
+					t.Fatalf("expected 100 or 101 but got %v at byte %v", c, i)
+				}
+				sum += int(c)
+			}
+			mean := float64(sum) / float64(len(actual.Pix)/4*3)
+			if expected := float64(level) / 257; mean < expected-0.05 || mean > expected+0.05 {
+				t.Fatalf("expected mean near %.2f but got %.2f", expected, mean)
+			}
+		})
+	}
+}
+
+func TestEncodeReductionChannels(t *testing.T) {
+	t.Parallel()
+
+	for _, alpha := range []uint16{0xff00, 0xff10, 0xff7e} {
+		alpha := alpha
+		t.Run("Should detect channels from reduced alpha 0x"+strconv.FormatUint(uint64(alpha), 16), func(t *testing.T) {
+			t.Parallel()
+			m := image.NewNRGBA64(image.Rect(0, 0, 3, 2))
+			for i := range m.Pix {
+				m.Pix[i] = 0xff
+			}
+			m.SetNRGBA64(1, 1, color.NRGBA64{0x1234, 0x5678, 0x9abc, alpha})
+			var buf bytes.Buffer
+			opts := &qoi.Options{Reduction: qoi.ReduceRound}
+
+			err := qoi.EncodeWithOptions(&buf, struct{ image.Image }{m}, opts)
+
+			if err != nil {
+				t.Fatalf("expected nil error, but got %v", err)
+			}
+			_, err = qoi.DecodeWithOptions(&buf, &qoi.DecodeOptions{Mode: qoi.DecodeStrict})
+			if err != nil {
+				t.Fatalf("expected nil error, but got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package qoi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+)
+
+var ErrRowCount = errors.New("wrong number of rows")
+
+var ErrClosed = errors.New("writer closed")
+
+// RowWriter encodes an image supplied a row at a time, so that the whole
+// image never has to be held in memory. The header is written with the
+// first rows or on Close. The first error is returned by every later call.
+type RowWriter struct {
+	e         *Encoder
+	header    Header
+	layout    PixelLayout
+	rows      int
+	started   bool
+	closed    bool
+	err       error
+	seeker    io.WriteSeeker
+	headerPos int64
+}
+
+func NewRowWriter(w io.Writer, header Header) *RowWriter {
+	layout := LayoutRGBA
+	if header.Channels == ChannelsRGB {
+		layout = LayoutRGB
+	}
+	return &RowWriter{
+		e: NewEncoder(w, &Options{
+			Channels:   header.Channels,
+			ColorSpace: header.ColorSpace,
+		}),
+		header: header,
+		layout: layout,
+	}
+}
+
+// NewSeekingRowWriter returns a RowWriter for images whose height is not
+// known in advance. header.Height is ignored and any number of rows may be
+// written. Close seeks back to patch the height in the header and then
+// returns to the end of the image.
+func NewSeekingRowWriter(w io.WriteSeeker, header Header) *RowWriter {
+	header.Height = 0
+	rw := NewRowWriter(w, header)
+	rw.seeker = w
+	return rw
+}
+
+// WriteRows encodes one or more complete rows. Rows are packed without
+// padding and use LayoutRGB or LayoutRGBA to match the header channels.
+func (rw *RowWriter) WriteRows(pix []byte) error {
+	if rw.closed {
+		return ErrClosed
+	}
+	if rw.err == nil {
+		rw.err = rw.writeRows(pix)
+	}
+	return rw.err
+}
+
+func (rw *RowWriter) writeRows(pix []byte) error {
+	err := rw.start()
+	if err != nil {
+		return err
+	}
+
+	width := int(rw.header.Width)
+	rowSize := width * rw.layout.BytesPerPixel()
+	if rowSize == 0 {
+		if len(pix) != 0 {
+			return fmt.Errorf("%v bytes for rows of width 0: %w", len(pix), ErrRowCount)
+		}
+		return nil
+	}
+	if len(pix)%rowSize != 0 {
+		return fmt.Errorf("%v bytes is not a multiple of row size %v: %w", len(pix), rowSize, ErrShortBuffer)
+	}
+	n := len(pix) / rowSize
+	maxRows := uint64(rw.header.Height)
+	if rw.seeker != nil {
+		maxRows = math.MaxUint32
+	}
+	if uint64(rw.rows+n) > maxRows {
+		return fmt.Errorf("%v rows after %v of %v: %w", n, rw.rows, rw.header.Height, ErrRowCount)
+	}
+
+	rw.e.src.resetRaw(pix, width, n, rowSize, rw.layout)
+	err = rw.e.encodeRows(0, n)
+	rw.e.src.clear()
+	rw.rows += n
+	return err
+}
+
+// start validates the header and writes it.
+func (rw *RowWriter) start() error {
+	if rw.started {
+		return nil
+	}
+	rw.started = true
+	if rw.header.Channels != ChannelsRGB && rw.header.Channels != ChannelsRGBA {
+		return fmt.Errorf("bad channels %v: %w", rw.header.Channels, ErrInvalidChannels)
+	}
+	rect := image.Rect(0, 0, int(rw.header.Width), int(rw.header.Height))
+	err := rw.e.opts.validate(rect)
+	if err != nil {
+		return err
+	}
+	if rw.header.Width == 0 {
+		rw.rows = int(rw.header.Height)
+	}
+	if rw.seeker != nil {
+		rw.headerPos, err = rw.seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return fmt.Errorf("cannot seek output: %w", err)
+		}
+	}
+
+	rw.e.start(rect)
+	rw.e.writeHeader()
+	return rw.e.out.err
+}
+
+// Close writes the end marker once all rows have been written. It does not
+// close the underlying writer.
+func (rw *RowWriter) Close() error {
+	if rw.closed {
+		return rw.err
+	}
+	rw.closed = true
+	if rw.err != nil {
+		return rw.err
+	}
+
+	rw.err = rw.start()
+	if rw.err == nil && rw.seeker == nil && uint64(rw.rows) != uint64(rw.header.Height) {
+		rw.err = fmt.Errorf("%v of %v rows written: %w", rw.rows, rw.header.Height, ErrRowCount)
+	}
+	if rw.err == nil {
+		rw.err = rw.e.finish()
+	}
+	if rw.err == nil && rw.seeker != nil {
+		rw.err = rw.patchHeight()
+	}
+	return rw.err
+}
+
+// patchHeight overwrites the provisional height in the header with the
+// number of rows written.
+func (rw *RowWriter) patchHeight() error {
+	end, err := rw.seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("cannot seek output: %w", err)
+	}
+	_, err = rw.seeker.Seek(rw.headerPos+8, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("cannot seek output: %w", err)
+	}
+	var height [4]byte
+	binary.BigEndian.PutUint32(height[:], uint32(rw.rows))
+	_, err = rw.seeker.Write(height[:])
+	if err != nil {
+		return err
+	}
+	_, err = rw.seeker.Seek(end, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("cannot seek output: %w", err)
+	}
+	rw.header.Height = uint32(rw.rows)
+	return nil
+}
+
+// RowReader decodes an image a row at a time, keeping only one row in
+// memory. It is used like bufio.Scanner:
+//
+//	for rr.Next() {
+//		row := rr.Row()
+//		...
+//	}
+//	if err := rr.Err(); err != nil {
+//		...
+//	}
+type RowReader struct {
+	d      *Decoder
+	header Header
+	row    []byte
+	rows   int
+	done   bool
+	err    error
+}
+
+// DefaultMaxRowWidth is the width limit for images decoded a row at a time
+// when DecodeOptions.MaxWidth is zero.
+const DefaultMaxRowWidth = 1 << 24
+
+// rowOptions returns a copy of opts for decoding that keeps a single row in
+// memory. Since the image size does not matter then, MaxPixels is ignored,
+// and the width is limited instead.
+func rowOptions(opts *DecodeOptions) *DecodeOptions {
+	var o DecodeOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxWidth == 0 {
+		o.MaxWidth = DefaultMaxRowWidth
+	}
+	o.MaxPixels = math.MaxUint64
+	return &o
+}
+
+// NewRowReader reads the header from r. A nil opts uses the defaults. Since
+// rows are not kept, the image size is not limited by MaxPixels, but the
+// width is limited by MaxWidth or DefaultMaxRowWidth.
+func NewRowReader(r io.Reader, opts *DecodeOptions) (*RowReader, error) {
+	d := NewDecoder(r, rowOptions(opts))
+	header, err := d.start()
+	if err != nil {
+		return nil, err
+	}
+	return &RowReader{
+		d:      d,
+		header: header,
+		row:    make([]byte, d.width*4),
+	}, nil
+}
+
+func (rr *RowReader) Header() Header {
+	return rr.header
+}
+
+// Next decodes the next row. It returns false after the last row, when the
+// end marker has been read, or on error.
+func (rr *RowReader) Next() bool {
+	if rr.done {
+		return false
+	}
+	if rr.rows == rr.d.height {
+		rr.done = true
+		rr.err = rr.d.finish()
+		return false
+	}
+
+	err := rr.d.decodePixels(rr.row)
+	if err != nil {
+		rr.done = true
+		rr.err = rr.d.wrapErr(err)
+		return false
+	}
+	rr.d.convertColorSpace(rr.row)
+	rr.rows++
+	return true
+}
+
+// Row returns the current row as NRGBA pixels. It is overwritten by the
+// next call to Next.
+func (rr *RowReader) Row() []byte {
+	return rr.row
+}
+
+// Y returns the index of the current row.
+func (rr *RowReader) Y() int {
+	return rr.rows - 1
+}
+
+func (rr *RowReader) Err() error {
+	return rr.err
+}
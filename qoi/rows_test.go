@@ -0,0 +1,328 @@
+package qoi_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/kropptrevor/go-qoi/qoi"
+)
+
+func TestRowWriter(t *testing.T) {
+	t.Parallel()
+
+	m := randomImages(image.Rect(0, 0, 29, 13))["NRGBA"].(*image.NRGBA)
+	header := qoi.Header{Width: 29, Height: 13, Channels: qoi.ChannelsRGBA}
+
+	for _, batch := range []int{1, 4, 13} {
+		batch := batch
+		t.Run("Should match Encode with batches of "+strconv.Itoa(batch)+" rows", func(t *testing.T) {
+			t.Parallel()
+			var expected bytes.Buffer
+			err := qoi.Encode(&expected, m, qoi.ChannelsRGBA)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var actual bytes.Buffer
+			rw := qoi.NewRowWriter(&actual, header)
+
+			for y := 0; y < 13; y += batch {
+				end := y + batch
+				if end > 13 {
+					end = 13
+				}
+				err = rw.WriteRows(m.Pix[y*m.Stride : end*m.Stride])
+				if err != nil {
+					t.Fatalf("expected nil error, but got %v", err)
+				}
+			}
+			err = rw.Close()
+
+			if err != nil {
+				t.Fatalf("expected nil error, but got %v", err)
+			}
+			if !bytes.Equal(expected.Bytes(), actual.Bytes()) {
+				t.Fatal("expected row output to match Encode output")
+			}
+		})
+	}
+
+	t.Run("Should write RGB rows", func(t *testing.T) {
+		t.Parallel()
+		expected := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+		copy(expected.Pix, []byte{1, 2, 3, 255, 4, 5, 6, 255})
+		var buf bytes.Buffer
+		rw := qoi.NewRowWriter(&buf, qoi.Header{Width: 2, Height: 1, Channels: qoi.ChannelsRGB})
+
+		err := rw.WriteRows([]byte{1, 2, 3, 4, 5, 6})
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		err = rw.Close()
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		actual, err := qoi.Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		imageEquals(t, expected, actual)
+	})
+
+	t.Run("Should fail with too many rows", func(t *testing.T) {
+		t.Parallel()
+		rw := qoi.NewRowWriter(&bytes.Buffer{}, header)
+		err := rw.WriteRows(m.Pix)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = rw.WriteRows(m.Pix[:m.Stride])
+
+		expected := qoi.ErrRowCount
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should fail on Close with too few rows", func(t *testing.T) {
+		t.Parallel()
+		rw := qoi.NewRowWriter(&bytes.Buffer{}, header)
+		err := rw.WriteRows(m.Pix[:m.Stride])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = rw.Close()
+
+		expected := qoi.ErrRowCount
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should fail with partial row", func(t *testing.T) {
+		t.Parallel()
+		rw := qoi.NewRowWriter(&bytes.Buffer{}, header)
+
+		err := rw.WriteRows(m.Pix[:m.Stride+4])
+
+		expected := qoi.ErrShortBuffer
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should fail with ChannelsAuto", func(t *testing.T) {
+		t.Parallel()
+		rw := qoi.NewRowWriter(&bytes.Buffer{}, qoi.Header{Width: 1, Height: 1})
+
+		err := rw.WriteRows([]byte{1, 2, 3, 4})
+
+		expected := qoi.ErrInvalidChannels
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should fail to write after Close", func(t *testing.T) {
+		t.Parallel()
+		rw := qoi.NewRowWriter(&bytes.Buffer{}, qoi.Header{Width: 1, Height: 0, Channels: qoi.ChannelsRGB})
+		err := rw.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = rw.WriteRows([]byte{1, 2, 3})
+
+		expected := qoi.ErrClosed
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+}
+
+type unseekableWriter struct {
+	bytes.Buffer
+}
+
+func (w *unseekableWriter) Seek(offset int64, whence int) (int64, error) {
+	return 0, errors.New("seek not supported")
+}
+
+func TestSeekingRowWriter(t *testing.T) {
+	t.Parallel()
+
+	m := randomImages(image.Rect(0, 0, 12, 7))["NRGBA"].(*image.NRGBA)
+
+	t.Run("Should patch the height on Close", func(t *testing.T) {
+		t.Parallel()
+		var expected bytes.Buffer
+		expected.WriteString("prefix")
+		err := qoi.Encode(&expected, m, qoi.ChannelsRGBA)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Create(filepath.Join(t.TempDir(), "rows.qoi"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		_, err = f.WriteString("prefix")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rw := qoi.NewSeekingRowWriter(f, qoi.Header{Width: 12, Channels: qoi.ChannelsRGBA})
+		for y := 0; y < 7; y++ {
+			err = rw.WriteRows(m.Pix[y*m.Stride : (y+1)*m.Stride])
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = rw.Close()
+
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		_, err = f.WriteString("suffix")
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected.WriteString("suffix")
+		if !bytes.Equal(expected.Bytes(), actual) {
+			t.Fatal("expected patched output to match Encode output")
+		}
+	})
+
+	t.Run("Should fail if the writer cannot seek", func(t *testing.T) {
+		t.Parallel()
+		rw := qoi.NewSeekingRowWriter(&unseekableWriter{}, qoi.Header{Width: 12, Channels: qoi.ChannelsRGBA})
+
+		err := rw.WriteRows(m.Pix[:m.Stride])
+
+		if err == nil {
+			t.Fatal("expected non-nil error")
+		}
+		if err := rw.Close(); err == nil {
+			t.Fatal("expected non-nil error on Close")
+		}
+	})
+}
+
+func TestRowReader(t *testing.T) {
+	t.Parallel()
+
+	m := randomImages(image.Rect(0, 0, 31, 9))["NRGBA"].(*image.NRGBA)
+	var encoded bytes.Buffer
+	err := qoi.Encode(&encoded, m, qoi.ChannelsRGBA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Should return the rows of Decode", func(t *testing.T) {
+		t.Parallel()
+		rr, err := qoi.NewRowReader(bytes.NewReader(encoded.Bytes()), nil)
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		if header := rr.Header(); header.Width != 31 || header.Height != 9 {
+			t.Fatalf("expected 31x9 header but got %vx%v", header.Width, header.Height)
+		}
+
+		rows := 0
+		for rr.Next() {
+			expected := m.Pix[rr.Y()*m.Stride : (rr.Y()+1)*m.Stride]
+			if !bytes.Equal(expected, rr.Row()) {
+				t.Fatalf("expected row %v to match", rr.Y())
+			}
+			rows++
+		}
+
+		if err := rr.Err(); err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+		if rows != 9 {
+			t.Fatalf("expected 9 rows but got %v", rows)
+		}
+	})
+
+	t.Run("Should report truncation", func(t *testing.T) {
+		t.Parallel()
+		data := encoded.Bytes()
+		rr, err := qoi.NewRowReader(bytes.NewReader(data[:len(data)/2]), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for rr.Next() {
+		}
+
+		expected := qoi.ErrTruncated
+		if err := rr.Err(); !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should read rows of images above the pixel limit", func(t *testing.T) {
+		t.Parallel()
+		data := []byte{'q', 'o', 'i', 'f', 0, 1, 0, 0, 0, 1, 0, 0, byte(qoi.ChannelsRGBA), qoi.ColorSpaceSRGB}
+		for i := 0; i < 1<<16/62+1; i++ {
+			data = append(data, qoi.TagRun|61)
+		}
+		rr, err := qoi.NewRowReader(bytes.NewReader(data), nil)
+		if err != nil {
+			t.Fatalf("expected nil error, but got %v", err)
+		}
+
+		if !rr.Next() {
+			t.Fatalf("expected a row but got %v", rr.Err())
+		}
+		if len(rr.Row()) != 4<<16 {
+			t.Fatalf("expected row of %v bytes but got %v", 4<<16, len(rr.Row()))
+		}
+	})
+
+	t.Run("Should reject widths above the default row limit", func(t *testing.T) {
+		t.Parallel()
+		data := []byte{'q', 'o', 'i', 'f', 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 1, byte(qoi.ChannelsRGBA), qoi.ColorSpaceSRGB}
+
+		_, err := qoi.NewRowReader(bytes.NewReader(data), nil)
+
+		expected := qoi.ErrTooLarge
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should honour MaxWidth", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := qoi.NewRowReader(bytes.NewReader(encoded.Bytes()), &qoi.DecodeOptions{MaxWidth: 30})
+
+		expected := qoi.ErrTooLarge
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+
+	t.Run("Should fail with bad header", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := qoi.NewRowReader(bytes.NewReader([]byte("qoix")), nil)
+
+		expected := qoi.ErrParseHeader
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+}
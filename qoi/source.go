@@ -0,0 +1,150 @@
+package qoi
+
+import (
+	"image"
+	"image/color"
+)
+
+// source reads rows of the encoded region. It reads the pixel slices of
+// common image types directly and falls back to At for everything else.
+// All paths produce the same values as color.NRGBAModel. A source without
+// an image reads raw pixels in the given layout instead.
+type source struct {
+	image   image.Image
+	rect    image.Rectangle
+	uniform rgba
+	palette [256]rgba
+	pix     []byte
+	stride  int
+	layout  PixelLayout
+}
+
+func (s *source) reset(m image.Image, rect image.Rectangle) {
+	s.image = m
+	s.rect = rect
+	s.pix = nil
+	switch m := m.(type) {
+	case *image.Paletted:
+		s.palette = [256]rgba{}
+		for i, c := range m.Palette {
+			if i == len(s.palette) {
+				break
+			}
+			s.palette[i] = newRGBA(c)
+		}
+
+	case *image.Uniform:
+		s.uniform = newRGBA(m.C)
+	}
+}
+
+// clear drops the references to the image or raw pixels, so that a pooled
+// Encoder does not keep them alive.
+func (s *source) clear() {
+	s.image = nil
+	s.pix = nil
+}
+
+func (s *source) resetRaw(pix []byte, width, height, stride int, layout PixelLayout) {
+	s.image = nil
+	s.rect = image.Rect(0, 0, width, height)
+	s.pix = pix
+	s.stride = stride
+	s.layout = layout
+}
+
+// readRow stores the pixels of row y of the region in row.
+func (s *source) readRow(y int, row []rgba) {
+	switch m := s.image.(type) {
+	case nil:
+		s.readRawRow(y, row)
+
+	case *image.NRGBA:
+		pix := m.Pix[m.PixOffset(s.rect.Min.X, y):]
+		for i := range row {
+			row[i] = rgba{pix[4*i], pix[4*i+1], pix[4*i+2], pix[4*i+3]}
+		}
+
+	case *image.RGBA:
+		pix := m.Pix[m.PixOffset(s.rect.Min.X, y):]
+		for i := range row {
+			row[i] = unpremultiply(pix[4*i], pix[4*i+1], pix[4*i+2], pix[4*i+3])
+		}
+
+	case *image.Gray:
+		pix := m.Pix[m.PixOffset(s.rect.Min.X, y):]
+		for i := range row {
+			row[i] = rgba{pix[i], pix[i], pix[i], 255}
+		}
+
+	case *image.Paletted:
+		pix := m.Pix[m.PixOffset(s.rect.Min.X, y):]
+		for i := range row {
+			row[i] = s.palette[pix[i]]
+		}
+
+	case *image.YCbCr:
+		for i := range row {
+			x := s.rect.Min.X + i
+			yi := m.YOffset(x, y)
+			ci := m.COffset(x, y)
+			r, g, b := color.YCbCrToRGB(m.Y[yi], m.Cb[ci], m.Cr[ci])
+			row[i] = rgba{r, g, b, 255}
+		}
+
+	case *image.Uniform:
+		for i := range row {
+			row[i] = s.uniform
+		}
+
+	default:
+		for i := range row {
+			row[i] = newRGBA(m.At(s.rect.Min.X+i, y))
+		}
+	}
+}
+
+func (s *source) readRawRow(y int, row []rgba) {
+	pix := s.pix[y*s.stride:]
+	switch s.layout {
+	case LayoutRGBA:
+		for i := range row {
+			row[i] = rgba{pix[4*i], pix[4*i+1], pix[4*i+2], pix[4*i+3]}
+		}
+
+	case LayoutBGRA:
+		for i := range row {
+			row[i] = rgba{pix[4*i+2], pix[4*i+1], pix[4*i], pix[4*i+3]}
+		}
+
+	case LayoutARGB:
+		for i := range row {
+			row[i] = rgba{pix[4*i+1], pix[4*i+2], pix[4*i+3], pix[4*i]}
+		}
+
+	case LayoutRGB:
+		for i := range row {
+			row[i] = rgba{pix[3*i], pix[3*i+1], pix[3*i+2], 255}
+		}
+
+	case LayoutBGR:
+		for i := range row {
+			row[i] = rgba{pix[3*i+2], pix[3*i+1], pix[3*i], 255}
+		}
+	}
+}
+
+func unpremultiply(r, g, b, a byte) rgba {
+	switch a {
+	case 255:
+		return rgba{r, g, b, a}
+	case 0:
+		return rgba{}
+	}
+	return rgba{
+		R: byte(uint32(r) * 0xffff / uint32(a) >> 8),
+		G: byte(uint32(g) * 0xffff / uint32(a) >> 8),
+		B: byte(uint32(b) * 0xffff / uint32(a) >> 8),
+		A: a,
+	}
+}
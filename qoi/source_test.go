@@ -0,0 +1,103 @@
+package qoi_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/kropptrevor/go-qoi/qoi"
+)
+
+func randomImages(rect image.Rectangle) map[string]image.Image {
+	rng := rand.New(rand.NewSource(1))
+	fill := func(pix []byte) {
+		for i := range pix {
+			// Runs of repeated bytes exercise the run and index chunks.
+			if i > 0 && rng.Intn(4) == 0 {
+				pix[i] = pix[i-1]
+				continue
+			}
+			pix[i] = byte(rng.Intn(256))
+		}
+	}
+
+	nrgba := image.NewNRGBA(rect)
+	fill(nrgba.Pix)
+
+	rgba := image.NewRGBA(rect)
+	fill(rgba.Pix)
+	for i := 0; i < len(rgba.Pix); i += 4 {
+		a := rgba.Pix[i+3]
+		for j := 0; j < 3; j++ {
+			if rgba.Pix[i+j] > a {
+				rgba.Pix[i+j] = a
+			}
+		}
+	}
+
+	gray := image.NewGray(rect)
+	fill(gray.Pix)
+
+	paletted := image.NewPaletted(rect, palette.Plan9)
+	fill(paletted.Pix)
+
+	ycbcr := image.NewYCbCr(rect, image.YCbCrSubsampleRatio420)
+	fill(ycbcr.Y)
+	fill(ycbcr.Cb)
+	fill(ycbcr.Cr)
+
+	return map[string]image.Image{
+		"NRGBA":    nrgba,
+		"RGBA":     rgba,
+		"Gray":     gray,
+		"Paletted": paletted,
+		"YCbCr":    ycbcr,
+		"Uniform":  image.NewUniform(color.NRGBA{10, 20, 30, 40}),
+	}
+}
+
+func TestEncodeImageTypes(t *testing.T) {
+	t.Parallel()
+
+	for name, m := range randomImages(image.Rect(-3, 5, 61, 50)) {
+		name, m := name, m
+		t.Run("Should encode "+name+" like generic image", func(t *testing.T) {
+			t.Parallel()
+			rect := image.Rect(-1, 7, 40, 33)
+			var expected bytes.Buffer
+			err := qoi.EncodeRegion(&expected, struct{ image.Image }{m}, rect, &qoi.Options{Channels: qoi.ChannelsRGBA})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var actual bytes.Buffer
+
+			err = qoi.EncodeRegion(&actual, m, rect, &qoi.Options{Channels: qoi.ChannelsRGBA})
+
+			if err != nil {
+				t.Fatalf("expected nil error, but got %v", err)
+			}
+			if !bytes.Equal(expected.Bytes(), actual.Bytes()) {
+				t.Fatal("expected output of fast path to match generic path")
+			}
+		})
+	}
+}
+
+func BenchmarkEncodeImageTypes(b *testing.B) {
+	for name, m := range randomImages(image.Rect(0, 0, 256, 256)) {
+		m := m
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				err := qoi.EncodeRegion(io.Discard, m, image.Rect(0, 0, 256, 256), nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
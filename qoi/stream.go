@@ -0,0 +1,59 @@
+package qoi
+
+import (
+	"errors"
+	"image"
+	"io"
+)
+
+// StreamReader decodes back-to-back QOI images from one stream.
+type StreamReader struct {
+	d   *Decoder
+	err error
+}
+
+func NewStreamReader(r io.Reader) *StreamReader {
+	return &StreamReader{
+		d: NewDecoder(r, nil),
+	}
+}
+
+// Next decodes the next image. It returns io.EOF when the stream ends
+// between images. After any other error the stream cannot be resumed and
+// Next keeps returning that error.
+func (s *StreamReader) Next() (image.Image, Header, error) {
+	if s.err != nil {
+		return nil, Header{}, s.err
+	}
+	before := s.d.input.offset
+	m, header, err := s.d.decode()
+	if errors.Is(err, ErrTruncated) && s.d.input.offset == before {
+		err = io.EOF
+	}
+	if err != nil {
+		s.err = err
+		return nil, Header{}, err
+	}
+	return m, header, nil
+}
+
+// StreamWriter encodes images back to back onto one io.Writer. Each image
+// is flushed as soon as it is written. After an error the stream may end in
+// a partial image, so every later write returns that error.
+type StreamWriter struct {
+	e   *Encoder
+	err error
+}
+
+func NewStreamWriter(w io.Writer, opts *Options) *StreamWriter {
+	return &StreamWriter{
+		e: NewEncoder(w, opts),
+	}
+}
+
+func (s *StreamWriter) WriteImage(m image.Image) error {
+	if s.err == nil {
+		s.err = s.e.Encode(m)
+	}
+	return s.err
+}
@@ -0,0 +1,93 @@
+package qoi_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/kropptrevor/go-qoi/qoi"
+)
+
+func TestStream(t *testing.T) {
+	t.Parallel()
+
+	images := []image.Image{
+		randomImages(image.Rect(0, 0, 9, 4))["NRGBA"],
+		randomImages(image.Rect(0, 0, 3, 11))["Gray"],
+		randomImages(image.Rect(0, 0, 1, 1))["NRGBA"],
+	}
+	var stream bytes.Buffer
+	sw := qoi.NewStreamWriter(&stream, nil)
+	for _, m := range images {
+		err := sw.WriteImage(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	readers := map[string]func([]byte) io.Reader{
+		"byte reader": func(data []byte) io.Reader { return bytes.NewReader(data) },
+		"half reader": func(data []byte) io.Reader { return iotest.HalfReader(bytes.NewReader(data)) },
+	}
+	for name, newReader := range readers {
+		newReader := newReader
+		t.Run("Should read each image from "+name, func(t *testing.T) {
+			t.Parallel()
+			sr := qoi.NewStreamReader(newReader(stream.Bytes()))
+
+			for _, expected := range images {
+				actual, header, err := sr.Next()
+				if err != nil {
+					t.Fatalf("expected nil error, but got %v", err)
+				}
+				if size := expected.Bounds().Size(); int(header.Width) != size.X || int(header.Height) != size.Y {
+					t.Fatalf("expected %v header but got %vx%v", size, header.Width, header.Height)
+				}
+				imageEquals(t, expected, actual)
+			}
+
+			_, _, err := sr.Next()
+			if err != io.EOF {
+				t.Fatalf("expected %q but got %q", io.EOF, err)
+			}
+		})
+	}
+
+	t.Run("Should not read past the end marker of a byte reader", func(t *testing.T) {
+		t.Parallel()
+		reader := bytes.NewReader(append(stream.Bytes(), "rest"...))
+		sr := qoi.NewStreamReader(reader)
+		for range images {
+			_, _, err := sr.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		rest, err := io.ReadAll(reader)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(rest) != "rest" {
+			t.Fatalf("expected %q but got %q", "rest", rest)
+		}
+	})
+
+	t.Run("Should report truncation inside an image", func(t *testing.T) {
+		t.Parallel()
+		sr := qoi.NewStreamReader(bytes.NewReader(stream.Bytes()[:stream.Len()-12]))
+		var err error
+		for err == nil {
+			_, _, err = sr.Next()
+		}
+
+		expected := qoi.ErrTruncated
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %q but got %q", expected, err)
+		}
+	})
+}